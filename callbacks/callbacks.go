@@ -31,15 +31,19 @@ func RegisterDefaultCallbacks(c *kom.ClusterInst) func() {
 
 	createCallback := k.Callback().Create()
 	_ = createCallback.Register("kom:create", Create)
+	_ = createCallback.After("kom:create").Register("kom:create:invalidate_cache", InvalidateCache)
 
 	updateCallback := k.Callback().Update()
 	_ = updateCallback.Register("kom:update", Update)
+	_ = updateCallback.After("kom:update").Register("kom:update:invalidate_cache", InvalidateCache)
 
 	patchCallback := k.Callback().Patch()
 	_ = patchCallback.Register("kom:patch", Patch)
+	_ = patchCallback.After("kom:patch").Register("kom:patch:invalidate_cache", InvalidateCache)
 
 	deleteCallback := k.Callback().Delete()
 	_ = deleteCallback.Register("kom:delete", Delete)
+	_ = deleteCallback.After("kom:delete").Register("kom:delete:invalidate_cache", InvalidateCache)
 
 	execCallback := k.Callback().Exec()
 	_ = execCallback.Register("kom:pod:exec", ExecuteCommand)
@@ -53,5 +57,8 @@ func RegisterDefaultCallbacks(c *kom.ClusterInst) func() {
 	describeCallback := k.Callback().Describe()
 	_ = describeCallback.Register("kom:describe", Describe)
 
+	tableCallback := k.Callback().Table()
+	_ = tableCallback.Register("kom:table", Table)
+
 	return nil
 }
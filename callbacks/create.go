@@ -24,15 +24,16 @@ func Create(k *kom.Kubectl) error {
 	}
 	unstructuredObj.SetUnstructuredContent(unstructuredData)
 	var res *unstructured.Unstructured
+	createOptions := metav1.CreateOptions{DryRun: stmt.DryRunOptions()}
 
 	if namespaced {
 		if ns == "" {
 			ns = metav1.NamespaceDefault
 			unstructuredObj.SetNamespace(ns)
 		}
-		res, err = stmt.Kubectl.DynamicClient().Resource(gvr).Namespace(ns).Create(ctx, unstructuredObj, metav1.CreateOptions{})
+		res, err = stmt.Kubectl.DynamicClient().Resource(gvr).Namespace(ns).Create(ctx, unstructuredObj, createOptions)
 	} else {
-		res, err = stmt.Kubectl.DynamicClient().Resource(gvr).Create(ctx, unstructuredObj, metav1.CreateOptions{})
+		res, err = stmt.Kubectl.DynamicClient().Resource(gvr).Create(ctx, unstructuredObj, createOptions)
 	}
 
 	if err != nil {
@@ -42,5 +43,6 @@ func Create(k *kom.Kubectl) error {
 	if stmt.RemoveManagedFields {
 		utils.RemoveManagedFields(res)
 	}
-	return nil
+	// 将 unstructured 转换回原始对象，试运行时为api server将要保存的对象
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(res.Object, stmt.Dest)
 }
@@ -18,7 +18,7 @@ func Delete(k *kom.Kubectl) error {
 	forceDelete := stmt.ForceDelete // 增加强制删除标志
 
 	// 修改删除选项以支持强制删除
-	deleteOptions := metav1.DeleteOptions{}
+	deleteOptions := metav1.DeleteOptions{DryRun: stmt.DryRunOptions()}
 	if forceDelete {
 		background := metav1.DeletePropagationBackground
 		deleteOptions.PropagationPolicy = &background
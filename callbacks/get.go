@@ -28,12 +28,22 @@ func Get(k *kom.Kubectl) error {
 		return err
 	}
 
-	cacheKey := fmt.Sprintf("%s/%s/%s/%s/%s", ns, name, gvr.Group, gvr.Resource, gvr.Version)
+	// 启用了informer缓存时从informer中获取，要求读取最新对象时跳过
+	if !stmt.ReadLatest {
+		if res, ok, err := stmt.InformerGet(ns, name); ok {
+			if err != nil {
+				return err
+			}
+			return fillGetResult(stmt, res.DeepCopy())
+		}
+	}
+
+	if namespaced && ns == "" {
+		ns = metav1.NamespaceDefault
+	}
+	cacheKey := stmt.GetCacheKey()
 	res, err := utils.GetOrSetCache(stmt.Kubectl.ClusterCache(), cacheKey, stmt.CacheTTL, func() (ret *unstructured.Unstructured, err error) {
 		if namespaced {
-			if ns == "" {
-				ns = metav1.NamespaceDefault
-			}
 			ret, err = stmt.Kubectl.DynamicClient().Resource(gvr).Namespace(ns).Get(ctx, name, metav1.GetOptions{})
 		} else {
 			ret, err = stmt.Kubectl.DynamicClient().Resource(gvr).Get(ctx, name, metav1.GetOptions{})
@@ -43,13 +53,20 @@ func Get(k *kom.Kubectl) error {
 	if err != nil {
 		return err
 	}
+	// 记录缓存key，写操作后清除
+	stmt.TrackCache(cacheKey, ns)
+
+	return fillGetResult(stmt, res)
+}
 
+// fillGetResult 将获取到的对象填充到Dest中
+func fillGetResult(stmt *kom.Statement, res *unstructured.Unstructured) error {
 	stmt.RowsAffected = 1
 	if stmt.RemoveManagedFields {
 		utils.RemoveManagedFields(res)
 	}
 	// 将 unstructured 转换回原始对象
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(res.Object, stmt.Dest)
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(res.Object, stmt.Dest)
 	if err != nil {
 		return err
 	}
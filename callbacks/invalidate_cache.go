@@ -0,0 +1,25 @@
+package callbacks
+
+import (
+	"github.com/weibaohui/kom/kom"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// InvalidateCache 创建、更新、Patch、删除成功后清除该资源在所在命名空间的Get、List缓存
+// 全部命名空间的列表缓存同时被清除，试运行不修改资源，不清除缓存
+func InvalidateCache(k *kom.Kubectl) error {
+	stmt := k.Statement
+	if stmt.DryRun {
+		return nil
+	}
+	if !stmt.Namespaced {
+		stmt.InvalidateCache()
+		return nil
+	}
+	ns := stmt.Namespace
+	if ns == "" {
+		ns = metav1.NamespaceDefault
+	}
+	stmt.InvalidateCache(ns)
+	return nil
+}
@@ -1,34 +1,28 @@
 package callbacks
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
 	"reflect"
-	"strings"
+	"sort"
 
-	"github.com/duke-git/lancet/v2/slice"
 	"github.com/duke-git/lancet/v2/stream"
 	"github.com/weibaohui/kom/kom"
 	"github.com/weibaohui/kom/utils"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/klog/v2"
 )
 
 func List(k *kom.Kubectl) error {
 
 	stmt := k.Statement
-	gvr := stmt.GVR
-	namespaced := stmt.Namespaced
-	ns := stmt.Namespace
-	ctx := stmt.Context
-	conditions := stmt.Filter.Conditions
-	namespaceList := stmt.NamespaceList
-
-	opts := stmt.ListOptions
-	listOptions := metav1.ListOptions{}
-	if len(opts) > 0 {
-		listOptions = opts[0]
+	if stmt.Each != nil {
+		// ListEach 逐个回调对象，不填充dest
+		return listEach(k)
 	}
 
 	// 使用反射获取 dest 的值
@@ -42,42 +36,32 @@ func List(k *kom.Kubectl) error {
 	// 获取切片的元素类型
 	elemType := destValue.Elem().Type().Elem()
 
-	cacheKey := fmt.Sprintf("%s/%s/%s/%s", ns, gvr.Group, gvr.Resource, gvr.Version)
-	list, err := utils.GetOrSetCache(stmt.ClusterCache(), cacheKey, stmt.CacheTTL, func() (list *unstructured.UnstructuredList, err error) {
-		// TODO 获取列表改为使用Option,解决大数据量获取问题。
-		if namespaced {
-			if stmt.AllNamespace || len(namespaceList) > 1 {
-				// 全部命名空间 或者  传入多个命名空间
-				// client-go 不支持跨命名空间查询，就全部查出来，后面再过滤
-				ns = metav1.NamespaceAll
-				list, err = stmt.Kubectl.DynamicClient().Resource(gvr).Namespace(ns).List(ctx, listOptions)
-			} else {
-				// 不是全部，也没有传多个命名空间
-				if ns == "" {
-					ns = metav1.NamespaceDefault
-				}
-				list, err = stmt.Kubectl.DynamicClient().Resource(gvr).Namespace(ns).List(ctx, listOptions)
-			}
-		} else {
-			// 集群级查询，不需要namespace
-			list, err = stmt.Kubectl.DynamicClient().Resource(gvr).List(ctx, listOptions)
-		}
-		return
-	})
+	having, err := stmt.ResolveSubqueries(stmt.Filter.Having)
 	if err != nil {
 		return err
 	}
-	if list == nil {
-		// 为空直接返回
-		return fmt.Errorf("list is nil")
+
+	var result []unstructured.Unstructured
+	var total int
+	if stmt.Items != nil {
+		// 多集群查询合并后的对象，已在各集群完成关联及where过滤
+		result = stmt.Items
+		total = len(result)
+	} else {
+		result, total, err = listFilteredItems(k)
+		if err != nil {
+			return err
+		}
 	}
-	if list.Items == nil {
-		// 为空直接返回
-		return fmt.Errorf("list Items is nil")
+	joined := len(stmt.Filter.Joins) > 0
+
+	aggregate := stmt.Filter.IsAggregate()
+	if aggregate {
+		// 对结果执行分组聚合，结果变为分组后的行，再执行having过滤
+		result = executeAggregate(result, stmt.Filter.Projections, stmt.Filter.GroupBy)
+		result = executeFilter(result, having)
 	}
 
-	// 对结果进行过滤，执行where 条件
-	result := executeFilter(list.Items, conditions)
 	if stmt.TotalCount != nil {
 		*stmt.TotalCount = int64(len(result))
 	}
@@ -86,8 +70,8 @@ func List(k *kom.Kubectl) error {
 		// 对结果执行OrderBy
 		klog.V(6).Infof("order by = %s", stmt.Filter.Order)
 		executeOrderBy(result, stmt.Filter.Order)
-	} else {
-		// 默认按创建时间倒序
+	} else if !aggregate && !joined {
+		// 默认按创建时间倒序，聚合结果已按分组值排序，关联结果保持主表顺序
 		utils.SortByCreationTime(result)
 	}
 
@@ -102,6 +86,23 @@ func List(k *kom.Kubectl) error {
 		streamTmp = streamTmp.Limit(stmt.Filter.Limit)
 	}
 
+	if aggregate || (joined && len(stmt.Filter.Projections) == 0) {
+		// 聚合结果已经是查询字段组成的行，关联查询select * 时返回以表别名为key的完整行
+		rows := make([]map[string]interface{}, 0)
+		for _, item := range streamTmp.ToSlice() {
+			rows = append(rows, runtime.DeepCopyJSON(item.Object))
+		}
+		stmt.RowsAffected = int64(total)
+		return fillRows(destValue, elemType, rows)
+	}
+
+	if len(stmt.Filter.Projections) > 0 {
+		// 指定了查询字段，按字段提取结果行
+		rows := executeProjection(streamTmp.ToSlice(), stmt.Filter.Projections)
+		stmt.RowsAffected = int64(total)
+		return fillRows(destValue, elemType, rows)
+	}
+
 	for _, item := range streamTmp.ToSlice() {
 
 		obj := item.DeepCopy()
@@ -116,7 +117,7 @@ func List(k *kom.Kubectl) error {
 		destValue.Elem().Set(reflect.Append(destValue.Elem(), newElemPtr.Elem()))
 
 	}
-	stmt.RowsAffected = int64(len(list.Items))
+	stmt.RowsAffected = int64(total)
 
 	if err != nil {
 		return err
@@ -124,79 +125,285 @@ func List(k *kom.Kubectl) error {
 	return nil
 }
 
-func executeOrderBy(result []unstructured.Unstructured, order string) {
-	// order by `metadata.name` asc, `metadata.host` asc
-	// todo 目前只实现了单一字段的排序，还没有搞定多个字段的排序
-	order = strings.TrimPrefix(strings.TrimSpace(order), "order by")
-	order = strings.TrimSpace(order)
-	orders := strings.Split(order, ",")
-	for _, ord := range orders {
-		var field string
-		var desc bool
-		// 判断排序方向
-		if strings.Contains(ord, "desc") {
-			desc = true
-			field = strings.ReplaceAll(ord, "desc", "")
-		} else {
-			field = strings.ReplaceAll(ord, "asc", "")
-		}
-		field = strings.TrimSpace(field)
-		field = strings.TrimSpace(utils.TrimQuotes(field))
-		klog.V(6).Infof("Sorting by field: %s, Desc: %v", field, desc)
-
-		slice.SortBy(result, func(a, b unstructured.Unstructured) bool {
-			// 获取字段值
-			aFieldValues, found, err := getNestedFieldAsString(a.Object, field)
-			if err != nil || !found {
-				return false
-			}
-			bFieldValues, found, err := getNestedFieldAsString(b.Object, field)
-			if err != nil || !found {
-				return false
+// listFilteredItems 查询资源并执行关联及where过滤，返回过滤后的对象及查询到的对象总数
+func listFilteredItems(k *kom.Kubectl) ([]unstructured.Unstructured, int, error) {
+	stmt := k.Statement
+	whereExpr, pushDown, listOptions, err := prepareList(k)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if (stmt.CacheTTL == 0 || stmt.InformerEnabled()) && len(stmt.Filter.Joins) == 0 {
+		// 不使用缓存或使用informer缓存时逐页过滤，只保留满足条件的对象，避免大数据量查询时全部对象同时驻留内存
+		result := make([]unstructured.Unstructured, 0)
+		total := 0
+		err = listPages(k, pushDown, listOptions, func(items []unstructured.Unstructured) error {
+			total += len(items)
+			if stmt.Filter.Cluster {
+				// 多集群查询，对象上增加虚拟字段cluster
+				items = withClusterColumn(items, k.ID)
 			}
+			result = append(result, executeFilter(items, whereExpr)...)
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		return result, total, nil
+	}
+
+	// 缓存及关联查询使用完整的列表
+	cacheKey := stmt.ListCacheKey(pushDown, listOptions)
+	list, err := utils.GetOrSetCache(stmt.ClusterCache(), cacheKey, stmt.CacheTTL, func() (*unstructured.UnstructuredList, error) {
+		list := &unstructured.UnstructuredList{Items: []unstructured.Unstructured{}}
+		err := listPages(k, pushDown, listOptions, func(items []unstructured.Unstructured) error {
+			list.Items = append(list.Items, items...)
+			return nil
+		})
+		return list, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	// 记录缓存key，写操作后清除
+	stmt.TrackCache(cacheKey, stmt.ListNamespaces(pushDown)...)
+	if list == nil {
+		// 为空直接返回
+		return nil, 0, fmt.Errorf("list is nil")
+	}
+
+	items := list.Items
+	if len(stmt.Filter.Joins) > 0 {
+		// 关联查询，结果变为以表别名为key的行
+		items, err = executeJoin(k, items)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if stmt.Filter.Cluster {
+		// 多集群查询，对象上增加虚拟字段cluster
+		items = withClusterColumn(items, k.ID)
+	}
 
-			// order by 必须把数组变为单一的值
-			if len(aFieldValues) > 1 || len(bFieldValues) > 1 {
-				return false
+	// 对结果进行过滤，执行where 条件
+	return executeFilter(items, whereExpr), len(list.Items), nil
+}
+
+// prepareList 执行条件中的子查询，并将api server可以执行的条件下推
+// 返回需要在本地过滤的条件、下推结果及合并了selector的ListOptions
+func prepareList(k *kom.Kubectl) (*kom.ConditionExpr, kom.PushDown, metav1.ListOptions, error) {
+	stmt := k.Statement
+	listOptions := metav1.ListOptions{}
+	if len(stmt.ListOptions) > 0 {
+		listOptions = stmt.ListOptions[0]
+	}
+
+	// 执行条件中的子查询
+	whereExpr, err := stmt.ResolveSubqueries(stmt.Filter.WhereExpr)
+	if err != nil {
+		return nil, kom.PushDown{}, listOptions, err
+	}
+
+	// 将api server可以执行的条件下推为label、field selector及命名空间，剩余条件在本地过滤
+	pushDown := stmt.PushDownWhere(whereExpr)
+	listOptions = pushDown.ApplyTo(listOptions)
+	return pushDown.Residual, pushDown, listOptions, nil
+}
+
+// listPages 分页查询资源，每获取一页调用一次fn
+// 资源启用了informer缓存时，从informer中一次取出全部对象
+// 未指定Limit、Continue时，按 PageSize 使用 Limit、Continue 分页获取全部对象
+// 调用方在ListOptions中指定了Limit或Continue时，按调用方的分页参数只查询一页
+func listPages(k *kom.Kubectl, pushDown kom.PushDown, listOptions metav1.ListOptions, fn func(items []unstructured.Unstructured) error) error {
+	stmt := k.Statement
+	ctx := stmt.Context
+
+	if virtual := stmt.Filter.Virtual; virtual != nil {
+		// 虚拟表查询父资源，将数组字段展开为行后再过滤
+		next := fn
+		fn = func(items []unstructured.Unstructured) error {
+			return next(virtual.Unnest(items))
+		}
+	}
+
+	namespaces := stmt.ListNamespaces(pushDown)
+	if items, ok, err := stmt.InformerList(namespaces, listOptions); ok {
+		if err != nil {
+			return err
+		}
+		return fn(items)
+	}
+
+	paged := listOptions.Limit == 0 && listOptions.Continue == ""
+	if paged {
+		listOptions.Limit = stmt.PageSize
+		if listOptions.Limit <= 0 {
+			listOptions.Limit = kom.DefaultPageSize
+		}
+	}
+	resource := stmt.Kubectl.DynamicClient().Resource(stmt.GVR)
+	for _, ns := range namespaces {
+		var client dynamic.ResourceInterface = resource
+		if stmt.Namespaced {
+			client = resource.Namespace(ns)
+		}
+		opt := listOptions
+		for {
+			list, err := client.List(ctx, opt)
+			if err != nil {
+				return err
 			}
-			if len(aFieldValues) == 0 || len(bFieldValues) == 0 {
-				return false
+			// 条件下推后，api server 返回的空列表 Items 为nil，按空结果处理
+			if err = fn(list.Items); err != nil {
+				return err
 			}
-			aFieldValue := aFieldValues[0]
-			bFieldValue := bFieldValues[0]
+			if !paged || list.GetContinue() == "" {
+				break
+			}
+			opt.Continue = list.GetContinue()
+		}
+	}
+	return nil
+}
 
-			t, va := utils.DetectType(aFieldValue)
-			_, vb := utils.DetectType(bFieldValue)
+// listEach 分页查询资源，逐页过滤后将满足条件的对象逐个交给 ListEach 的回调函数
+// 按api server返回的顺序回调，支持limit、offset及查询字段
+func listEach(k *kom.Kubectl) error {
+	stmt := k.Statement
+	filter := stmt.Filter
+	if filter.Order != "" || filter.IsAggregate() || len(filter.Joins) > 0 {
+		return fmt.Errorf("ListEach 不支持 order by、group by、聚合函数及关联查询，请使用 List")
+	}
+	whereExpr, pushDown, listOptions, err := prepareList(k)
+	if err != nil {
+		return err
+	}
 
-			switch t {
-			case utils.TypeString:
-				if desc {
-					return va.(string) > vb.(string)
-				}
-				return va.(string) < vb.(string)
-			case utils.TypeNumber:
-				if desc {
-					return va.(float64) > vb.(float64)
-				}
-				return va.(float64) < vb.(float64)
-			case utils.TypeTime:
-				tva, err := utils.ParseTime(fmt.Sprintf("%s", va))
-				if err != nil {
-					return false
-				}
-				tvb, err := utils.ParseTime(fmt.Sprintf("%s", vb))
-				if err != nil {
-					return false
+	shared := stmt.InformerEnabled()
+	skip := filter.Offset
+	count := 0
+	err = listPages(k, pushDown, listOptions, func(items []unstructured.Unstructured) error {
+		for i := range items {
+			obj := &items[i]
+			if whereExpr != nil && !evaluateExpr(*obj, whereExpr) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(filter.Projections) > 0 {
+				// 指定了查询字段，回调查询字段组成的行
+				obj = &unstructured.Unstructured{Object: projectColumns(obj.Object, filter.Projections)}
+			} else {
+				if shared {
+					// 对象来自informer缓存，复制后再交给回调函数
+					obj = obj.DeepCopy()
 				}
-				if desc {
-					return tva.After(tvb)
+				if stmt.RemoveManagedFields {
+					utils.RemoveManagedFields(obj)
 				}
-				return tva.Before(tvb)
-			default:
-				return false
 			}
-		})
+			if err := stmt.Each(obj); err != nil {
+				return err
+			}
+			count++
+			if filter.Limit > 0 && count >= filter.Limit {
+				return kom.ErrStopEach
+			}
+		}
+		return nil
+	})
+	stmt.RowsAffected = int64(count)
+	if errors.Is(err, kom.ErrStopEach) {
+		return nil
+	}
+	return err
+}
+
+// withClusterColumn 为对象增加虚拟字段cluster，浅拷贝对象，不修改缓存中的对象
+func withClusterColumn(items []unstructured.Unstructured, cluster string) []unstructured.Unstructured {
+	result := make([]unstructured.Unstructured, 0, len(items))
+	for _, item := range items {
+		obj := make(map[string]interface{}, len(item.Object)+1)
+		for key, value := range item.Object {
+			obj[key] = value
+		}
+		obj[kom.ClusterColumn] = cluster
+		result = append(result, unstructured.Unstructured{Object: obj})
+	}
+	return result
+}
 
+// executeOrderBy 按排序子句对结果进行排序
+// 支持多字段排序，依次比较各字段，前一个字段相等时再比较下一个字段
+// 使用稳定排序，所有字段均相等时保持原有顺序
+func executeOrderBy(result []unstructured.Unstructured, order string) {
+	fields := kom.ParseOrderBy(order)
+	if len(fields) == 0 {
+		return
+	}
+	for _, f := range fields {
+		klog.V(6).Infof("Sorting by field: %s, Desc: %v, NullsFirst: %v", f.Field, f.Desc, f.NullsFirst)
+	}
+
+	// 预先取出各对象的排序字段值，避免排序过程中重复解析
+	keys := make([][][]string, len(result))
+	for i, item := range result {
+		keys[i] = make([][]string, len(fields))
+		for j, f := range fields {
+			values, found, err := getNestedFieldAsString(item.Object, f.Field)
+			if err == nil && found {
+				keys[i][j] = values
+			}
+		}
 	}
 
+	indexes := make([]int, len(result))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		a, b := keys[indexes[i]], keys[indexes[j]]
+		for k, f := range fields {
+			if c := compareOrderValues(a[k], b[k], f); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	sorted := make([]unstructured.Unstructured, len(result))
+	for i, idx := range indexes {
+		sorted[i] = result[idx]
+	}
+	copy(result, sorted)
+}
+
+// compareOrderValues 按排序字段的方向比较两个对象的字段值
+// 字段值为数组时，逐个元素比较，元素都相等时元素少的在前
+func compareOrderValues(a, b []string, f kom.OrderField) int {
+	// 字段不存在的情况，按nulls first/last 放置，不受升降序影响
+	if len(a) == 0 || len(b) == 0 {
+		if len(a) == len(b) {
+			return 0
+		}
+		aIsNull := len(a) == 0
+		if aIsNull == f.NullsFirst {
+			return -1
+		}
+		return 1
+	}
+	c := 0
+	for i := 0; i < len(a) && i < len(b) && c == 0; i++ {
+		c = compareFieldValues(a[i], b[i])
+	}
+	if c == 0 {
+		c = cmp.Compare(len(a), len(b))
+	}
+	if f.Desc {
+		return -c
+	}
+	return c
 }
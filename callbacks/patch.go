@@ -8,6 +8,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 func Patch(k *kom.Kubectl) error {
@@ -27,13 +28,18 @@ func Patch(k *kom.Kubectl) error {
 		err = fmt.Errorf("patch对象必须指定名称")
 		return err
 	}
+	patchOptions := metav1.PatchOptions{FieldManager: stmt.FieldManager, DryRun: stmt.DryRunOptions()}
+	if patchType == types.ApplyPatchType && stmt.ForceApply {
+		// force 只能用于服务端应用
+		patchOptions.Force = utils.BoolPtr(true)
+	}
 	if namespaced {
 		if ns == "" {
 			ns = metav1.NamespaceDefault
 		}
-		res, err = stmt.Kubectl.DynamicClient().Resource(gvr).Namespace(ns).Patch(ctx, name, patchType, []byte(patchData), metav1.PatchOptions{})
+		res, err = stmt.Kubectl.DynamicClient().Resource(gvr).Namespace(ns).Patch(ctx, name, patchType, []byte(patchData), patchOptions)
 	} else {
-		res, err = stmt.Kubectl.DynamicClient().Resource(gvr).Patch(ctx, name, patchType, []byte(patchData), metav1.PatchOptions{})
+		res, err = stmt.Kubectl.DynamicClient().Resource(gvr).Patch(ctx, name, patchType, []byte(patchData), patchOptions)
 	}
 	if err != nil {
 		return err
@@ -0,0 +1,179 @@
+package callbacks
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/weibaohui/kom/kom"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+)
+
+// executeAggregate 按分组字段对结果进行分组，并计算聚合函数
+// 每个分组生成一行，行中包含查询字段，字段以别名或字段路径为key，聚合字段未设置别名时以 count(*) 形式为key
+// 没有分组字段时，全部结果作为一个分组，即使结果为空也返回一行，如 count(*) 为 0
+// 返回的行以 unstructured.Unstructured 承载，便于继续执行 having、order by 等处理
+func executeAggregate(result []unstructured.Unstructured, columns []kom.Column, groupBy []string) []unstructured.Unstructured {
+	var keys []string
+	groups := make(map[string][]unstructured.Unstructured)
+	for _, item := range result {
+		key := groupKey(item.Object, groupBy)
+		if _, exists := groups[key]; !exists {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], item)
+	}
+	if len(groupBy) == 0 && len(keys) == 0 {
+		// 没有分组字段，空结果也要返回一行聚合结果
+		keys = append(keys, "")
+	}
+	// 默认按分组值排序，保证结果稳定
+	sort.Strings(keys)
+
+	if len(columns) == 0 {
+		// select * group by xx，返回分组字段及数量
+		for _, field := range groupBy {
+			columns = append(columns, kom.Column{Field: field})
+		}
+		columns = append(columns, kom.Column{Field: "*", Func: "count"})
+	}
+
+	rows := make([]unstructured.Unstructured, 0, len(keys))
+	for _, key := range keys {
+		items := groups[key]
+		row := make(map[string]interface{}, len(columns))
+		for _, column := range columns {
+			if column.Func != "" {
+				row[column.Name()] = aggregateColumn(items, column)
+				continue
+			}
+			// 普通字段取分组内第一个对象的值，分组字段在组内都是相同的
+			if len(items) > 0 {
+				row[column.Name()] = projectValue(items[0].Object, column.Field)
+			} else {
+				row[column.Name()] = nil
+			}
+		}
+		rows = append(rows, unstructured.Unstructured{Object: row})
+	}
+	return rows
+}
+
+// groupKey 计算对象的分组key
+func groupKey(obj map[string]interface{}, groupBy []string) string {
+	parts := make([]string, 0, len(groupBy))
+	for _, field := range groupBy {
+		values, _, _ := getNestedFieldAsString(obj, field)
+		parts = append(parts, strings.Join(values, ","))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// aggregateColumn 计算单个聚合字段
+func aggregateColumn(items []unstructured.Unstructured, column kom.Column) interface{} {
+	if column.Func == "count" && column.Field == "*" {
+		return int64(len(items))
+	}
+
+	// 收集组内全部字段值，数组属性会展开为多个值，如 sum(status.containerStatuses.restartCount)
+	var values []string
+	var count int64
+	for _, item := range items {
+		fieldValues, found, err := getNestedFieldAsString(item.Object, column.Field)
+		if err != nil || !found {
+			continue
+		}
+		count++
+		values = append(values, fieldValues...)
+	}
+
+	switch column.Func {
+	case "count":
+		return count
+	case "sum":
+		return sumValues(values)
+	case "avg":
+		if len(values) == 0 {
+			return nil
+		}
+		if sum, ok := sumNumbers(values); ok {
+			return sum / float64(len(values))
+		}
+		// 资源数量求平均值，如 avg(spec.containers.resources.requests.cpu)
+		total, n := sumQuantities(values)
+		if n == 0 {
+			klog.V(6).Infof("avg(%s) values are not numbers or quantities", column.Field)
+			return nil
+		}
+		return resource.NewMilliQuantity(total.MilliValue()/int64(n), total.Format).String()
+	case "min", "max":
+		if len(values) == 0 {
+			return nil
+		}
+		target := values[0]
+		for _, v := range values[1:] {
+			c := compareFieldValues(v, target)
+			if (column.Func == "min" && c < 0) || (column.Func == "max" && c > 0) {
+				target = v
+			}
+		}
+		return normalizeValue(target)
+	default:
+		return nil
+	}
+}
+
+// sumValues 求和，均为数字时按数字求和，否则按k8s资源数量（如 100m、1Gi）求和
+func sumValues(values []string) interface{} {
+	if sum, ok := sumNumbers(values); ok {
+		if sum == math.Trunc(sum) {
+			return int64(sum)
+		}
+		return sum
+	}
+	total, _ := sumQuantities(values)
+	return total.String()
+}
+
+// sumQuantities 按k8s资源数量求和，返回合计及参与求和的数量，忽略无法解析的值
+func sumQuantities(values []string) (resource.Quantity, int) {
+	total := resource.Quantity{}
+	n := 0
+	for _, v := range values {
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			klog.V(6).Infof("sum ignore value %s: %v", v, err)
+			continue
+		}
+		total.Add(q)
+		n++
+	}
+	return total, n
+}
+
+// sumNumbers 按数字求和，存在非数字时返回false
+func sumNumbers(values []string) (float64, bool) {
+	var sum float64
+	for _, v := range values {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, false
+		}
+		sum += f
+	}
+	return sum, true
+}
+
+// normalizeValue 将字符串形式的数字还原为数字，其他保持字符串
+func normalizeValue(v string) interface{} {
+	if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	}
+	return v
+}
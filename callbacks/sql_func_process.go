@@ -0,0 +1,334 @@
+package callbacks
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/weibaohui/kom/kom"
+	"github.com/weibaohui/kom/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	kom.RegisterSqlFunc("json_extract", jsonExtract)
+}
+
+// funcCall 字段中的函数调用，如 lower(metadata.name)、coalesce(spec.replicas, 1)
+type funcCall struct {
+	name string
+	args []funcArg
+}
+
+// funcArg 函数参数，为常量、字段路径或嵌套的函数调用
+type funcArg struct {
+	literal bool        // 是否为常量
+	value   interface{} // 常量值，字符串为string，数字为float64
+	field   string      // 字段路径
+	call    *funcCall   // 嵌套的函数调用
+}
+
+// funcCallCacheSize 函数调用缓存的最大数量，超过后清空重建
+const funcCallCacheSize = 1024
+
+var (
+	// funcCallCache 解析后的函数调用缓存，不是函数调用的字段缓存为nil
+	funcCallCache     = make(map[string]*funcCall)
+	funcCallCacheLock sync.RWMutex
+)
+
+// parseFuncCall 解析字段中的函数调用，字段不是 name(args) 形式时返回false
+func parseFuncCall(path string) (*funcCall, bool) {
+	funcCallCacheLock.RLock()
+	call, ok := funcCallCache[path]
+	funcCallCacheLock.RUnlock()
+	if ok {
+		return call, call != nil
+	}
+	call = parseFuncCallExpr(strings.TrimSpace(path))
+	funcCallCacheLock.Lock()
+	if len(funcCallCache) >= funcCallCacheSize {
+		funcCallCache = make(map[string]*funcCall)
+	}
+	funcCallCache[path] = call
+	funcCallCacheLock.Unlock()
+	return call, call != nil
+}
+
+// parseFuncCallExpr 解析 name(arg1, arg2)，参数按顶层逗号拆分，引号内的内容保持不变
+func parseFuncCallExpr(s string) *funcCall {
+	open := strings.IndexByte(s, '(')
+	if open <= 0 || !strings.HasSuffix(s, ")") || indexCallEnd(s, open) != len(s)-1 {
+		return nil
+	}
+	name := strings.TrimSpace(s[:open])
+	for _, c := range name {
+		if c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			return nil
+		}
+	}
+	call := &funcCall{name: strings.ToLower(name)}
+	inner := strings.TrimSpace(s[open+1 : len(s)-1])
+	if inner == "" {
+		return call
+	}
+	for _, part := range utils.SplitTopLevel(inner, ',') {
+		call.args = append(call.args, parseFuncArg(strings.TrimSpace(part)))
+	}
+	return call
+}
+
+// indexCallEnd 查找与 open 位置的左括号匹配的右括号
+func indexCallEnd(s string, open int) int {
+	var quote byte
+	depth := 0
+	for i := open; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseFuncArg 解析单个函数参数
+func parseFuncArg(arg string) funcArg {
+	if kom.IsQuoted(arg) {
+		return funcArg{literal: true, value: unescapeLiteral(arg[1 : len(arg)-1])}
+	}
+	switch strings.ToLower(arg) {
+	case "null":
+		return funcArg{literal: true}
+	case "true", "false":
+		return funcArg{literal: true, value: strings.EqualFold(arg, "true")}
+	}
+	if num, err := strconv.ParseFloat(arg, 64); err == nil {
+		return funcArg{literal: true, value: num}
+	}
+	if call := parseFuncCallExpr(arg); call != nil {
+		return funcArg{call: call}
+	}
+	return funcArg{field: strings.ReplaceAll(arg, "`", "")}
+}
+
+// unescapeLiteral 去掉sql字符串常量中的转义，如 \' 转换为 '
+func unescapeLiteral(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(s[i])
+			}
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// getFuncValues 计算函数调用的值，返回值为nil时视为字段不存在，返回数组时作为多个值
+func getFuncValues(obj interface{}, call *funcCall) ([]interface{}, bool, error) {
+	value, err := evalFuncCall(obj, call)
+	if err != nil {
+		return nil, false, err
+	}
+	switch v := value.(type) {
+	case nil:
+		return nil, false, nil
+	case []interface{}:
+		return v, len(v) > 0, nil
+	}
+	return []interface{}{value}, true, nil
+}
+
+// evalFuncCall 按已注册的函数计算函数调用的值
+// 字段参数取到单个值时传入该值，取到多个值时传入[]interface{}，未取到时传入nil
+func evalFuncCall(obj interface{}, call *funcCall) (interface{}, error) {
+	fn, ok := kom.GetSqlFunc(call.name)
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", call.name)
+	}
+	args := make([]interface{}, 0, len(call.args))
+	for _, arg := range call.args {
+		switch {
+		case arg.literal:
+			args = append(args, arg.value)
+		case arg.call != nil:
+			v, err := evalFuncCall(obj, arg.call)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+		default:
+			values, found, err := getNestedFieldValues(obj, arg.field)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case !found:
+				args = append(args, nil)
+			case len(values) == 1:
+				args = append(args, values[0])
+			default:
+				args = append(args, values)
+			}
+		}
+	}
+	value, err := fn(args...)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeFuncValue(value), nil
+}
+
+// normalizeFuncValue 将函数返回值转换为JSON值，避免后续深拷贝时panic
+// 整数转换为int64，浮点数转换为float64，时间转换为RFC3339字符串，数组及map逐个转换，其他类型转换为字符串
+func normalizeFuncValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, int64, float64, json.Number:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return v.Format(time.RFC3339)
+	case metav1.Time:
+		return v.Format(time.RFC3339)
+	case *metav1.Time:
+		if v == nil {
+			return nil
+		}
+		return v.Format(time.RFC3339)
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u)
+		}
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String:
+		return rv.String()
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return normalizeFuncValue(rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		values := make([]interface{}, rv.Len())
+		for i := range values {
+			values[i] = normalizeFuncValue(rv.Index(i).Interface())
+		}
+		return values
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+		values := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			values[fmt.Sprint(iter.Key().Interface())] = normalizeFuncValue(iter.Value().Interface())
+		}
+		return values
+	}
+	return fmt.Sprint(value)
+}
+
+// jsonExtract json_extract(doc, path) 按JSON路径取值
+// doc 为JSON字符串时先解析，也可以直接使用对象字段，如 json_extract(metadata.annotations, '$."kubectl.kubernetes.io/restartedAt"')
+// path 以$开头，支持 $.a.b、$."a.b"、$.a[0]、$.a[*]，取到多个值时返回多个值
+func jsonExtract(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("json_extract: wrong number of arguments %d", len(args))
+	}
+	path, ok := args[1].(string)
+	if !ok || !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("json_extract: invalid path %v", args[1])
+	}
+
+	doc := args[0]
+	if str, ok := doc.(string); ok {
+		if err := json.Unmarshal([]byte(str), &doc); err != nil {
+			// 不是JSON字符串，没有值
+			return nil, nil
+		}
+	}
+	if doc == nil {
+		return nil, nil
+	}
+
+	fieldPath := jsonPathToFieldPath(path[1:])
+	if fieldPath == "" {
+		return doc, nil
+	}
+	steps, err := kom.ParseFieldPath(fieldPath)
+	if err != nil {
+		return nil, fmt.Errorf("json_extract: invalid path %s", path)
+	}
+	values := getFieldValues(doc, steps)
+	switch len(values) {
+	case 0:
+		return nil, nil
+	case 1:
+		return values[0], nil
+	}
+	return values, nil
+}
+
+// jsonPathToFieldPath 将JSON路径转换为字段路径，."a.b" 转换为 ["a.b"]
+func jsonPathToFieldPath(path string) string {
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '.' && i+1 < len(path) && path[i+1] == '"' {
+			end := strings.IndexByte(path[i+2:], '"')
+			if end >= 0 {
+				sb.WriteString(`["` + path[i+2:i+2+end] + `"]`)
+				i = i + 2 + end
+				continue
+			}
+		}
+		sb.WriteByte(path[i])
+	}
+	return strings.TrimPrefix(sb.String(), ".")
+}
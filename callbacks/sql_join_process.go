@@ -0,0 +1,109 @@
+package callbacks
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/weibaohui/kom/kom"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+)
+
+// executeJoin 执行关联查询
+// 主表及关联表的对象均以表别名为key放入结果行，如 {"p": pod对象, "n": node对象}
+// 关联表通过List回调获取，按on条件中的字段值建立hash索引后与已有结果行进行关联
+// 字段为数组属性时（如 p.metadata.ownerReferences.uid），任意一个值相等即视为关联成功
+func executeJoin(k *kom.Kubectl, items []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	stmt := k.Statement
+	alias := stmt.Filter.Alias
+
+	rows := make([]unstructured.Unstructured, 0, len(items))
+	for _, item := range items {
+		rows = append(rows, unstructured.Unstructured{Object: map[string]interface{}{alias: item.Object}})
+	}
+
+	for _, join := range stmt.Filter.Joins {
+		var joinItems []unstructured.Unstructured
+		err := kom.Cluster(k.ID).
+			WithContext(stmt.Context).
+			From(join.Table).
+			AllNamespace().
+			WithCache(stmt.CacheTTL).
+			List(&joinItems).Error
+		if err != nil {
+			return nil, fmt.Errorf("join %s error: %v", join.Table, err)
+		}
+		klog.V(6).Infof("join %s as %s, %d items", join.Table, join.Alias, len(joinItems))
+
+		// 关联表按on条件字段值建立索引
+		index := make(map[string][]int)
+		for i, joinItem := range joinItems {
+			obj := map[string]interface{}{join.Alias: joinItem.Object}
+			for _, key := range joinKeys(obj, join.RightFields) {
+				index[key] = append(index[key], i)
+			}
+		}
+
+		joined := make([]unstructured.Unstructured, 0, len(rows))
+		for _, row := range rows {
+			// 同一个关联对象可能通过多个值匹配，需要去重
+			matched := make(map[int]bool)
+			for _, key := range joinKeys(row.Object, join.LeftFields) {
+				for _, i := range index[key] {
+					if matched[i] {
+						continue
+					}
+					matched[i] = true
+					joined = append(joined, mergeJoinRow(row, join.Alias, joinItems[i].Object))
+				}
+			}
+			if len(matched) == 0 && join.Type == "left join" {
+				// left join 未关联到对象时，保留结果行，关联表的值为nil
+				joined = append(joined, mergeJoinRow(row, join.Alias, nil))
+			}
+		}
+		rows = joined
+	}
+	return rows, nil
+}
+
+// joinKeys 计算对象在关联字段上的全部key
+// 多个关联字段时，各字段值组合为一个key；字段为数组属性时，每个值生成一个key
+// 与where中的=一致，key不区分大小写
+func joinKeys(obj map[string]interface{}, fields []string) []string {
+	keys := []string{""}
+	for i, field := range fields {
+		values, found, err := getNestedFieldAsString(obj, field)
+		if err != nil || !found {
+			return nil
+		}
+		next := make([]string, 0, len(keys)*len(values))
+		for _, key := range keys {
+			for _, v := range values {
+				v = strings.ToLower(v)
+				if i > 0 {
+					next = append(next, key+"\x00"+v)
+				} else {
+					next = append(next, v)
+				}
+			}
+		}
+		keys = next
+	}
+	return keys
+}
+
+// mergeJoinRow 将关联对象以别名为key加入结果行，返回新的结果行
+func mergeJoinRow(row unstructured.Unstructured, alias string, obj map[string]interface{}) unstructured.Unstructured {
+	merged := make(map[string]interface{}, len(row.Object)+1)
+	for k, v := range row.Object {
+		merged[k] = v
+	}
+	if obj != nil {
+		merged[alias] = obj
+	} else {
+		// 避免写入类型为map的nil值
+		merged[alias] = nil
+	}
+	return unstructured.Unstructured{Object: merged}
+}
@@ -0,0 +1,61 @@
+package callbacks
+
+import (
+	"reflect"
+
+	"github.com/weibaohui/kom/kom"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// executeProjection 按查询字段提取结果，每个对象生成一行
+// 字段路径规则与where条件一致，取到单个值时直接返回该值，取到多个值时（数组属性）返回值列表，未取到时为nil
+func executeProjection(result []unstructured.Unstructured, columns []kom.Column) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(result))
+	for _, item := range result {
+		rows = append(rows, projectColumns(item.Object, columns))
+	}
+	return rows
+}
+
+// projectColumns 提取单个对象的查询字段
+func projectColumns(obj map[string]interface{}, columns []kom.Column) map[string]interface{} {
+	row := make(map[string]interface{}, len(columns))
+	for _, column := range columns {
+		row[column.Name()] = projectValue(obj, column.Field)
+	}
+	return row
+}
+
+// projectValue 获取单个字段的值
+func projectValue(obj map[string]interface{}, field string) interface{} {
+	values, found, err := getNestedFieldValues(obj, field)
+	if err != nil || !found {
+		return nil
+	}
+	// 返回值与缓存中的对象隔离，避免调用方修改结果影响缓存
+	if len(values) == 1 {
+		return runtime.DeepCopyJSONValue(values[0])
+	}
+	return runtime.DeepCopyJSONValue(values)
+}
+
+// fillRows 将查询结果行写入目标切片
+// 目标元素类型为 map[string]interface{} 时直接使用，为 unstructured.Unstructured 时作为Object，其他类型按json tag转换
+func fillRows(destValue reflect.Value, elemType reflect.Type, rows []map[string]interface{}) error {
+	for _, row := range rows {
+		newElemPtr := reflect.New(elemType)
+		switch dest := newElemPtr.Interface().(type) {
+		case *map[string]interface{}:
+			*dest = row
+		case *unstructured.Unstructured:
+			dest.Object = row
+		default:
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(row, dest); err != nil {
+				return err
+			}
+		}
+		destValue.Elem().Set(reflect.Append(destValue.Elem(), newElemPtr.Elem()))
+	}
+	return nil
+}
@@ -1,106 +1,64 @@
 package callbacks
 
 import (
+	"cmp"
 	"fmt"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/duke-git/lancet/v2/slice"
 	"github.com/weibaohui/kom/kom"
 	"github.com/weibaohui/kom/utils"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/klog/v2"
 )
 
 // executeFilter 使用 lancet 执行过滤
-func executeFilter(result []unstructured.Unstructured, conditions []kom.Condition) []unstructured.Unstructured {
-
-	// 最终的结果，按照条件列表，逐一执行过滤
-
-	// 2. 按 and or 分组
-	groupedConditions := groupByOperator(conditions)
-
-	// 3. 目前暂时改为支持简单的 and or 逻辑。不管括号。
-	// TODO 需要处理复杂的括号等逻辑情况
-	// keys and or
-	keys := make([]string, 0, len(groupedConditions))
-	for k := range groupedConditions {
-		keys = append(keys, k)
-	}
-
-	// 3. 按and or 两组 逐个访问 map 并处理
-	for _, key := range keys {
-		// 这个key == and or
-		group := slice.Filter(conditions, func(index int, item kom.Condition) bool {
-			return item.AndOr == key
-		})
-		// 按组进行过滤，一般一组为相同的and or 条件
-		result = evaluateCondition(result, group)
-
-	}
-
-	return result
-}
-
-func groupByDepth(conditions []kom.Condition) map[int][]kom.Condition {
-	groups := make(map[int][]kom.Condition)
-	for _, p := range conditions {
-		depth := p.Depth
-		groups[depth] = append(groups[depth], p)
-	}
-	return groups
-}
-func groupByOperator(conditions []kom.Condition) map[string][]kom.Condition {
-	groups := make(map[string][]kom.Condition)
-	for _, p := range conditions {
-		operator := p.AndOr
-		groups[operator] = append(groups[operator], p)
+// 按where条件表达式树逐个对象求值，括号、AND、OR、NOT 均按表达式树的结构处理
+func executeFilter(result []unstructured.Unstructured, expr *kom.ConditionExpr) []unstructured.Unstructured {
+	if expr == nil {
+		return result
 	}
-	return groups
-}
-func evaluateCondition(result []unstructured.Unstructured, group []kom.Condition) []unstructured.Unstructured {
-
-	// 一般一组 and or 都相同
-	if group[0].AndOr == "OR" {
-		return matchAny(result, group)
-	} else {
-		return matchAll(result, group)
-	}
-}
-
-// matchAll 判断所有条件都满足 (AND 逻辑)
-func matchAll(result []unstructured.Unstructured, conditions []kom.Condition) []unstructured.Unstructured {
 	return slice.Filter(result, func(index int, item unstructured.Unstructured) bool {
-		// 遍历所有条件，只有全部条件成立才返回 true
-		for _, c := range conditions {
-			condition := matchCondition(item, c)
-			klog.V(8).Infof("matchAny %s/%s  %s  %s  %s = %v", item.GetNamespace(), item.GetName(), c.Field, c.Operator, c.Value, condition)
-			if !condition {
-				return false // 只要有一个条件不成立，直接返回 false
-			}
-		}
-		return true // 所有条件都成立，返回 true
+		return evaluateExpr(item, expr)
 	})
 }
 
-// matchAny 判断任一条件满足 (OR 逻辑)
-func matchAny(result []unstructured.Unstructured, conditions []kom.Condition) []unstructured.Unstructured {
-	return slice.Filter(result, func(index int, item unstructured.Unstructured) bool {
-		// 遍历所有条件，任意一个条件成立就返回 true
-		for _, c := range conditions {
-			condition := matchCondition(item, c)
-			klog.V(8).Infof("matchAny %s/%s  %s  %s  %s = %v", item.GetNamespace(), item.GetName(), c.Field, c.Operator, c.Value, condition)
-			if condition {
-				// 任意一个条件达成，就返回。
-				// 没有达成不要返回，让他执行下一个条件
+// evaluateExpr 对单个对象计算条件表达式树的结果
+func evaluateExpr(item unstructured.Unstructured, expr *kom.ConditionExpr) bool {
+	switch expr.Logic {
+	case "AND":
+		// 所有子表达式都成立才返回 true
+		for _, child := range expr.Children {
+			if !evaluateExpr(item, child) {
+				return false
+			}
+		}
+		return true
+	case "OR":
+		// 任意一个子表达式成立就返回 true
+		for _, child := range expr.Children {
+			if evaluateExpr(item, child) {
 				return true
 			}
 		}
 		return false
-	})
+	case "NOT":
+		return !evaluateExpr(item, expr.Children[0])
+	default:
+		if expr.Condition == nil {
+			return true
+		}
+		c := *expr.Condition
+		condition := matchCondition(item, c)
+		klog.V(8).Infof("evaluateExpr %s/%s  %s  %s  %s = %v", item.GetNamespace(), item.GetName(), c.Field, c.Operator, c.Value, condition)
+		return condition
+	}
 }
 
 // matchCondition 判断单个条件是否匹配
@@ -121,6 +79,16 @@ func matchAny(result []unstructured.Unstructured, conditions []kom.Condition) []
 func matchCondition(resource unstructured.Unstructured, condition kom.Condition) bool {
 	klog.V(6).Infof("matchCondition  %s %s %s", condition.Field, condition.Operator, condition.Value)
 
+	switch condition.Operator {
+	case "is null":
+		return !fieldExists(resource.Object, condition.Field)
+	case "is not null":
+		return fieldExists(resource.Object, condition.Field)
+	}
+
+	// now() - interval 7 day 等相对时间，按当前时间计算
+	condition.Value = resolveTimeValue(condition.Value)
+
 	// 获取字段值
 	fieldValues, found, err := getNestedFieldAsString(resource.Object, condition.Field)
 	if err != nil || !found {
@@ -144,6 +112,18 @@ func matchCondition(resource unstructured.Unstructured, condition kom.Condition)
 			if compareLike(fieldValue, condition.Value) {
 				return true
 			}
+		case "not like":
+			if compareLike(fieldValue, condition.Value) {
+				return false
+			}
+		case "regexp":
+			if compareRegexp(fieldValue, condition.Value) {
+				return true
+			}
+		case "not regexp":
+			if compareRegexp(fieldValue, condition.Value) {
+				return false
+			}
 		case "in":
 			if compareIn(fieldValue, condition.Value) {
 				return true
@@ -184,11 +164,12 @@ func matchCondition(resource unstructured.Unstructured, condition kom.Condition)
 	// 获取到的值，是一个列表，属于yaml中的列表属性，那么需要综合思考了。
 
 	// 判断是正向条件还是负向条件
-	isNegativeCondition := condition.Operator == "!=" || condition.Operator == "not in" || condition.Operator == "not between"
+	isNegativeCondition := condition.Operator == "!=" || condition.Operator == "not in" || condition.Operator == "not between" ||
+		condition.Operator == "not like" || condition.Operator == "not regexp"
 
 	// 处理每个字段值
 	for _, fieldValue := range fieldValues {
-		// 对于负向条件（!=, not in, not between），需要确保所有值都不满足条件
+		// 对于负向条件（!=, not in, not between, not like, not regexp），需要确保所有值都不满足条件
 		switch condition.Operator {
 		case "=":
 			if !isNegativeCondition && compareValue(fieldValue, condition.Value) {
@@ -202,6 +183,18 @@ func matchCondition(resource unstructured.Unstructured, condition kom.Condition)
 			if !isNegativeCondition && compareLike(fieldValue, condition.Value) {
 				return true
 			}
+		case "not like":
+			if isNegativeCondition && compareLike(fieldValue, condition.Value) {
+				return false
+			}
+		case "regexp":
+			if !isNegativeCondition && compareRegexp(fieldValue, condition.Value) {
+				return true
+			}
+		case "not regexp":
+			if isNegativeCondition && compareRegexp(fieldValue, condition.Value) {
+				return false
+			}
 		case "in":
 			if !isNegativeCondition && compareIn(fieldValue, condition.Value) {
 				return true
@@ -248,13 +241,93 @@ func matchCondition(resource unstructured.Unstructured, condition kom.Condition)
 	return false
 }
 
+// resolveTimeValue 将条件值中的相对时间转换为当前对应的时间
+func resolveTimeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case utils.RelativeTime:
+		return v.Time()
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, item := range v {
+			resolved[i] = resolveTimeValue(item)
+		}
+		return resolved
+	}
+	return value
+}
+
+// fieldExists 判断字段是否存在且不为null，数组字段中任意一个元素存在该字段即为存在
+func fieldExists(obj interface{}, path string) bool {
+	values, found, err := getNestedFieldValues(obj, path)
+	if err != nil || !found {
+		return false
+	}
+	for _, v := range values {
+		if v != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// regexpCacheSize 正则表达式缓存的最大数量，超过后清空重建
+const regexpCacheSize = 512
+
+var (
+	regexpCache     = make(map[string]*regexp.Regexp)
+	regexpCacheLock sync.RWMutex
+)
+
+// compiledRegexp 获取编译后的正则表达式，编译结果按表达式缓存，避免每个对象重复编译
+func compiledRegexp(pattern string) (*regexp.Regexp, error) {
+	regexpCacheLock.RLock()
+	re, ok := regexpCache[pattern]
+	regexpCacheLock.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexpCacheLock.Lock()
+	if len(regexpCache) >= regexpCacheSize {
+		regexpCache = make(map[string]*regexp.Regexp)
+	}
+	regexpCache[pattern] = re
+	regexpCacheLock.Unlock()
+	return re, nil
+}
+
+// compareRegexp 判断字段值是否匹配正则表达式，区分大小写，可使用 (?i) 忽略大小写
+func compareRegexp(fieldValue string, value interface{}) bool {
+	re, err := compiledRegexp(fmt.Sprintf("%v", value))
+	if err != nil {
+		klog.V(6).Infof("compareRegexp (regexp) %s error %v", value, err)
+		return false
+	}
+	return re.MatchString(fieldValue)
+}
+
 // compareValue 比较值是否相等，不区分大小写
 func compareValue(fieldValue string, value interface{}) bool {
 	klog.V(8).Infof("compareValue (=) %s,%v(%v)", fieldValue, value, reflect.TypeOf(value))
 
 	switch v := value.(type) {
 	case string:
-		return strings.ToLower(fieldValue) == strings.ToLower(v)
+		if strings.EqualFold(fieldValue, v) {
+			return true
+		}
+		// 资源数量按数量比较，如 1Gi = 1024Mi
+		if _, ok := utils.ParseQuantity(v); ok {
+			c, ok := compareQuantity(fieldValue, v)
+			return ok && c == 0
+		}
+		return false
+	case resource.Quantity:
+		c, ok := compareQuantity(fieldValue, v)
+		return ok && c == 0
 	case float64, int, int64:
 		fieldValFloat, err := strconv.ParseFloat(fieldValue, 64)
 		if err != nil {
@@ -268,6 +341,12 @@ func compareValue(fieldValue string, value interface{}) bool {
 			return false
 		}
 		return fieldTime.Equal(v)
+	case bool:
+		fieldValBool, err := strconv.ParseBool(fieldValue)
+		if err != nil {
+			return false
+		}
+		return fieldValBool == v
 	default:
 		return false
 	}
@@ -311,7 +390,9 @@ func compareGreater(fieldValue string, value interface{}) bool {
 	case float64:
 		fieldValFloat, err := strconv.ParseFloat(fieldValue, 64)
 		if err != nil {
-			return false
+			// 字段值为资源数量，如 cpu: 500m
+			c, ok := compareQuantity(fieldValue, v)
+			return ok && c > 0
 		}
 		return fieldValFloat > v
 	case int, int64:
@@ -321,15 +402,16 @@ func compareGreater(fieldValue string, value interface{}) bool {
 		}
 		return fieldValFloat > float64(v.(int))
 	case string:
-		fieldValFloat, err := strconv.ParseFloat(fieldValue, 64)
-		if err != nil {
-			return false
-		}
-		valueFloat, err := strconv.ParseFloat(v, 64)
-		if err != nil {
-			return false
+		fieldValFloat, err1 := strconv.ParseFloat(fieldValue, 64)
+		valueFloat, err2 := strconv.ParseFloat(v, 64)
+		if err1 != nil || err2 != nil {
+			c, ok := compareQuantity(fieldValue, v)
+			return ok && c > 0
 		}
 		return fieldValFloat > valueFloat
+	case resource.Quantity:
+		c, ok := compareQuantity(fieldValue, v)
+		return ok && c > 0
 	case time.Time:
 		fieldValTime, err := utils.ParseTime(fieldValue)
 		if err != nil {
@@ -351,7 +433,9 @@ func compareLess(fieldValue string, value interface{}) bool {
 	case float64:
 		fieldValFloat, err := strconv.ParseFloat(fieldValue, 64)
 		if err != nil {
-			return false
+			// 字段值为资源数量，如 cpu: 500m
+			c, ok := compareQuantity(fieldValue, v)
+			return ok && c < 0
 		}
 		return fieldValFloat < v
 	case int, int64:
@@ -361,15 +445,16 @@ func compareLess(fieldValue string, value interface{}) bool {
 		}
 		return fieldValFloat < float64(v.(int))
 	case string:
-		fieldValFloat, err := strconv.ParseFloat(fieldValue, 64)
-		if err != nil {
-			return false
-		}
-		valueFloat, err := strconv.ParseFloat(v, 64)
-		if err != nil {
-			return false
+		fieldValFloat, err1 := strconv.ParseFloat(fieldValue, 64)
+		valueFloat, err2 := strconv.ParseFloat(v, 64)
+		if err1 != nil || err2 != nil {
+			c, ok := compareQuantity(fieldValue, v)
+			return ok && c < 0
 		}
 		return fieldValFloat < valueFloat
+	case resource.Quantity:
+		c, ok := compareQuantity(fieldValue, v)
+		return ok && c < 0
 	case time.Time:
 		fieldValTime, err := utils.ParseTime(fieldValue)
 		if err != nil {
@@ -389,7 +474,9 @@ func compareGreaterOrEqual(fieldValue string, value interface{}) bool {
 	case float64:
 		fieldValFloat, err := strconv.ParseFloat(fieldValue, 64)
 		if err != nil {
-			return false
+			// 字段值为资源数量，如 cpu: 500m
+			c, ok := compareQuantity(fieldValue, v)
+			return ok && c >= 0
 		}
 		return fieldValFloat >= v
 	case int, int64:
@@ -399,15 +486,16 @@ func compareGreaterOrEqual(fieldValue string, value interface{}) bool {
 		}
 		return fieldValFloat >= float64(v.(int))
 	case string:
-		fieldValFloat, err := strconv.ParseFloat(fieldValue, 64)
-		if err != nil {
-			return false
-		}
-		valueFloat, err := strconv.ParseFloat(v, 64)
-		if err != nil {
-			return false
+		fieldValFloat, err1 := strconv.ParseFloat(fieldValue, 64)
+		valueFloat, err2 := strconv.ParseFloat(v, 64)
+		if err1 != nil || err2 != nil {
+			c, ok := compareQuantity(fieldValue, v)
+			return ok && c >= 0
 		}
 		return fieldValFloat >= valueFloat
+	case resource.Quantity:
+		c, ok := compareQuantity(fieldValue, v)
+		return ok && c >= 0
 	case time.Time:
 		fieldValTime, err := utils.ParseTime(fieldValue)
 		if err != nil {
@@ -429,7 +517,9 @@ func compareLessOrEqual(fieldValue string, value interface{}) bool {
 	case float64:
 		fieldValFloat, err := strconv.ParseFloat(fieldValue, 64)
 		if err != nil {
-			return false
+			// 字段值为资源数量，如 cpu: 500m
+			c, ok := compareQuantity(fieldValue, v)
+			return ok && c <= 0
 		}
 		return fieldValFloat <= v
 	case int, int64:
@@ -439,15 +529,16 @@ func compareLessOrEqual(fieldValue string, value interface{}) bool {
 		}
 		return fieldValFloat <= float64(v.(int))
 	case string:
-		fieldValFloat, err := strconv.ParseFloat(fieldValue, 64)
-		if err != nil {
-			return false
-		}
-		valueFloat, err := strconv.ParseFloat(v, 64)
-		if err != nil {
-			return false
+		fieldValFloat, err1 := strconv.ParseFloat(fieldValue, 64)
+		valueFloat, err2 := strconv.ParseFloat(v, 64)
+		if err1 != nil || err2 != nil {
+			c, ok := compareQuantity(fieldValue, v)
+			return ok && c <= 0
 		}
 		return fieldValFloat <= valueFloat
+	case resource.Quantity:
+		c, ok := compareQuantity(fieldValue, v)
+		return ok && c <= 0
 	case time.Time:
 		fieldValTime, err := utils.ParseTime(fieldValue)
 		if err != nil {
@@ -460,62 +551,108 @@ func compareLessOrEqual(fieldValue string, value interface{}) bool {
 	}
 }
 
+// compareQuantity 按k8s资源数量比较字段值与条件值，如 500m < 1、1Gi > 512Mi
+// a<b 返回-1，a==b 返回0，a>b 返回1，任意一个无法解析为资源数量时返回false
+func compareQuantity(fieldValue string, value interface{}) (int, bool) {
+	var target resource.Quantity
+	switch v := value.(type) {
+	case resource.Quantity:
+		target = v
+	case string:
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			return 0, false
+		}
+		target = q
+	case float64:
+		q, err := resource.ParseQuantity(strconv.FormatFloat(v, 'f', -1, 64))
+		if err != nil {
+			return 0, false
+		}
+		target = q
+	default:
+		return 0, false
+	}
+	fieldQuantity, err := resource.ParseQuantity(fieldValue)
+	if err != nil {
+		return 0, false
+	}
+	return fieldQuantity.Cmp(target), true
+}
+
 // compareIn 判断值是否在列表中
+// value 为in列表解析得到的切片，字符串保持原样，数字为float64，绑定的参数保持其类型
 func compareIn(fieldValue string, value interface{}) bool {
 
 	klog.V(6).Infof("compareIn(in []) %s,%v(%v)", fieldValue, value, reflect.TypeOf(value))
 
-	// value 类型字符串 = (1,2,3,4) ，这个格式决定了只能是string类型
-	// 如何判断fieldValue 是否在1,2,3,4范围内?
-	if str, ok := value.(string); ok {
-		// 去掉首尾的括号
-		str = strings.TrimPrefix(str, "(")
-		str = strings.TrimSuffix(str, ")")
-		// 以逗号分割
-		values := strings.Split(str, ",")
-		for _, v := range values {
-			v = strings.Trim(v, " ")
-			v = utils.TrimQuotes(v)
-			// 时间、字符串、数字
-			// 只有相等，才能返回，因为in操作符，是or的关系。一个不行，需要判断下一个。
-
-			// 先按数字比较
-			fieldValueNum, err1 := strconv.ParseFloat(fieldValue, 64)
-			toNum, err2 := strconv.ParseFloat(v, 64)
-			if err1 == nil && err2 == nil {
-				if fieldValueNum == toNum {
-					return true
-				}
+	values, ok := value.([]interface{})
+	if !ok {
+		return false
+	}
+	// 只有相等，才能返回，因为in操作符，是or的关系。一个不行，需要判断下一个。
+	for _, v := range values {
+		if compareInValue(fieldValue, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareInValue 判断字段值是否与in列表中的一个值相等
+func compareInValue(fieldValue string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		// 时间、字符串、数字
+		// 先按数字比较
+		fieldValueNum, err1 := strconv.ParseFloat(fieldValue, 64)
+		toNum, err2 := strconv.ParseFloat(v, 64)
+		if err1 == nil && err2 == nil {
+			if fieldValueNum == toNum {
+				return true
 			}
+		}
 
-			// 时间不能简单判断，而要判断是否日期、小时、分钟，是否in。
-			// 是否包含时间部分，如果包含，就是精确匹配。如果不不含，就是判断日期
-			fieldValueTime, err1 := utils.ParseTime(fieldValue)
-			toTime, err2 := utils.ParseTime(v)
-			if err1 == nil && err2 == nil {
-
-				// 判断目标时间字符串是否包含时间部分（即时分秒）
-				if hasTimeComponent(v) {
-					// 逐级比较时间分量（小时、分钟、秒）
-					if fieldValueTime.Hour() == toTime.Hour() &&
-						fieldValueTime.Minute() == toTime.Minute() &&
-						fieldValueTime.Second() == toTime.Second() {
-						return true
-					}
-				}
-				// 比较日期部分（年、月、日）
-				if isSameDate(fieldValueTime, toTime) {
+		// 时间不能简单判断，而要判断是否日期、小时、分钟，是否in。
+		// 是否包含时间部分，如果包含，就是精确匹配。如果不不含，就是判断日期
+		fieldValueTime, err1 := utils.ParseTime(fieldValue)
+		toTime, err2 := utils.ParseTime(v)
+		if err1 == nil && err2 == nil {
+
+			// 判断目标时间字符串是否包含时间部分（即时分秒）
+			if hasTimeComponent(v) {
+				// 逐级比较时间分量（小时、分钟、秒）
+				if fieldValueTime.Hour() == toTime.Hour() &&
+					fieldValueTime.Minute() == toTime.Minute() &&
+					fieldValueTime.Second() == toTime.Second() {
 					return true
 				}
 			}
-
-			if fieldValue == v {
+			// 比较日期部分（年、月、日）
+			if isSameDate(fieldValueTime, toTime) {
 				return true
 			}
-
 		}
+
+		return fieldValue == v
+	default:
+		// 数字、布尔、时间按类型比较
+		return compareValue(fieldValue, v)
+	}
+}
+
+// rangeBound 将between的边界值转换为字符串
+func rangeBound(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case resource.Quantity:
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", v)
 	}
-	return false
 }
 
 // 判断是否包含时间部分
@@ -534,16 +671,20 @@ func isSameDate(t1, t2 time.Time) bool {
 func compareBetween(fieldValue string, value interface{}) bool {
 	klog.V(6).Infof("compareBetween (between x and y) %s,%v(%v)", fieldValue, value, reflect.TypeOf(value))
 
-	// value格式 举例: 1 and 5 这个格式决定了只能是string类型
-	// 正则表达式匹配 "from AND to"
+	// value格式 举例: [1, 5]，兼容 1 and 5 字符串格式
 	var from, to string
-	re := regexp.MustCompile(`(?i)(.+?)\s+AND\s+(.+)`)
-	matches := re.FindStringSubmatch(fmt.Sprintf("%v", value))
+	if bounds, ok := value.([]interface{}); ok && len(bounds) == 2 {
+		// 解析得到的 [from, to]，绑定的参数转换为字符串后按相同的规则比较
+		from, to = rangeBound(bounds[0]), rangeBound(bounds[1])
+	} else {
+		re := regexp.MustCompile(`(?i)(.+?)\s+AND\s+(.+)`)
+		matches := re.FindStringSubmatch(fmt.Sprintf("%v", value))
 
-	// 如果匹配成功，提取出 from 和 to
-	if len(matches) == 3 {
-		from = matches[1]
-		to = matches[2]
+		// 如果匹配成功，提取出 from 和 to
+		if len(matches) == 3 {
+			from = matches[1]
+			to = matches[2]
+		}
 	}
 
 	// 判断 from to 是否为时间类型、数字类、还是字符串
@@ -574,109 +715,139 @@ func compareBetween(fieldValue string, value interface{}) bool {
 		}
 	}
 
-	// 3. 作为字符串比较
+	// 3. 尝试作为资源数量比较，如 500m between 100m and 1
+	if c1, ok := compareQuantity(fieldValue, from); ok {
+		if c2, ok := compareQuantity(fieldValue, to); ok {
+			return c1 >= 0 && c2 <= 0
+		}
+	}
+
+	// 4. 作为字符串比较
 	return fieldValue >= from && fieldValue <= to
 }
 
+// compareFieldValues 按值的类型比较两个字段值，a<b 返回-1，a==b 返回0，a>b 返回1
+// 两个值均为数字时按数字比较，均为时间时按时间比较，均为资源数量（如 500m 与 2）时按数量比较，否则按字符串比较
+func compareFieldValues(a, b string) int {
+	if fa, err1 := strconv.ParseFloat(a, 64); err1 == nil {
+		if fb, err2 := strconv.ParseFloat(b, 64); err2 == nil {
+			return cmp.Compare(fa, fb)
+		}
+	}
+	if ta, err1 := utils.ParseTime(a); err1 == nil {
+		if tb, err2 := utils.ParseTime(b); err2 == nil {
+			return ta.Compare(tb)
+		}
+	}
+	if qa, ok := utils.ParseQuantity(a); ok {
+		if c, ok := compareQuantity(b, qa); ok {
+			return -c
+		}
+	} else if _, ok := utils.ParseQuantity(b); ok {
+		if c, ok := compareQuantity(a, b); ok {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
+
 // getNestedFieldAsString 获取嵌套字段值，支持数组筛选并处理数组返回值
 func getNestedFieldAsString(obj interface{}, path string) ([]string, bool, error) {
-	fields, arrayCondition, err := parsePathWithCondition(path)
-	if err != nil {
-		return nil, false, err
+	values, found, err := getNestedFieldValues(obj, path)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	results := make([]string, 0, len(values))
+	for _, v := range values {
+		results = append(results, fmt.Sprintf("%v", v))
 	}
-	return getFieldValues(obj, fields, arrayCondition)
+	return results, true, nil
 }
 
-// parsePathWithCondition 解析路径，支持数组条件筛选
-func parsePathWithCondition(path string) ([]string, map[string]string, error) {
-	// 用 . 分割路径
-	parts := strings.Split(path, ".")
-	var arrayCondition map[string]string
-
-	// 检查是否包含条件（如 [type=InternalIP]）
-	if len(parts) > 1 && strings.Contains(parts[1], "[") {
-		// 提取字段和条件
-		conditionPart := parts[1]
-		startIndex := strings.Index(conditionPart, "[")
-		endIndex := strings.Index(conditionPart, "]")
-
-		// 提取字段和条件
-		field := conditionPart[:startIndex]
-		condition := conditionPart[startIndex+1 : endIndex]
-		conditionParts := strings.Split(condition, "=")
-
-		if len(conditionParts) == 2 {
-			arrayCondition = map[string]string{conditionParts[0]: conditionParts[1]}
-			// 重新组装路径，去掉条件部分
-			parts[1] = field
+// getNestedFieldValues 获取嵌套字段的原始值，路径规则见 kom.ParseFieldPath
+// 完整路径作为key存在时优先使用，用于聚合结果行中 count(*)、metadata.namespace 等以完整名称为key的字段
+func getNestedFieldValues(obj interface{}, path string) ([]interface{}, bool, error) {
+	if m, ok := obj.(map[string]interface{}); ok {
+		if val, exists := m[path]; exists {
+			if val == nil {
+				return nil, false, nil
+			}
+			return []interface{}{val}, true, nil
 		}
 	}
-
-	return parts, arrayCondition, nil
+	if call, ok := parseFuncCall(path); ok {
+		// lower(metadata.name)、len(spec.containers) 等函数调用
+		return getFuncValues(obj, call)
+	}
+	steps, err := kom.ParseFieldPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	values := getFieldValues(obj, steps)
+	return values, len(values) > 0, nil
 }
 
-// getFieldValues 递归获取字段值，支持数组筛选并返回多个值
-func getFieldValues(obj interface{}, fields []string, arrayCondition map[string]string) ([]string, bool, error) {
-	if len(fields) == 0 {
+// getFieldValues 按路径递归获取字段值，数组展开、下标、筛选后可能返回多个值
+func getFieldValues(obj interface{}, steps []kom.FieldPathStep) []interface{} {
+	if len(steps) == 0 {
 		if obj != nil {
-			return []string{fmt.Sprintf("%v", obj)}, true, nil
+			return []interface{}{obj}
 		}
-		return nil, false, nil
+		return nil
 	}
 
-	currentField := fields[0]
-	remainingFields := fields[1:]
-
+	step := steps[0]
 	switch v := obj.(type) {
 	case map[string]interface{}:
-		// 从 map 中获取值
-		if val, exists := v[currentField]; exists {
-			return getFieldValues(val, remainingFields, arrayCondition)
-		}
-		return nil, false, nil
-	case []map[string]interface{}:
-		// 遍历数组，筛选符合条件的项
-		var results []string
-		for _, item := range v {
-			if matchCondition2(item, arrayCondition) {
-				// 条件匹配，递归获取剩余字段
-				if val, found, err := getFieldValues(item, remainingFields, nil); found || err != nil {
-					results = append(results, val...)
-				}
-			}
+		if step.Key == "" {
+			// 下标、筛选只能作用于数组
+			return nil
+		}
+		if val, exists := v[step.Key]; exists {
+			return getFieldValues(val, steps[1:])
 		}
-		return results, len(results) > 0, nil
+		return nil
 	case []interface{}:
-		// 如果是 interface{} 数组，逐项判断
-		var results []string
-		for _, item := range v {
-			if val, found, err := getFieldValues(item, fields, arrayCondition); found || err != nil {
-				results = append(results, val...)
+		var results []interface{}
+		switch {
+		case step.IsIndex:
+			index := step.Index
+			if index < 0 {
+				index += len(v)
+			}
+			if index >= 0 && index < len(v) {
+				results = getFieldValues(v[index], steps[1:])
+			}
+		case step.Wildcard:
+			for _, item := range v {
+				results = append(results, getFieldValues(item, steps[1:])...)
+			}
+		case step.Filter != nil:
+			for _, item := range v {
+				if matchArrayFilter(item, step.Filter) {
+					results = append(results, getFieldValues(item, steps[1:])...)
+				}
+			}
+		default:
+			// 按key取值时，对数组中的每个元素取值
+			for _, item := range v {
+				results = append(results, getFieldValues(item, steps)...)
 			}
 		}
-		return results, len(results) > 0, nil
-	case string:
-		if len(fields) == 0 {
-			return []string{v}, true, nil
-		}
-		return nil, false, nil
-	case bool, int, int64, float64:
-		if len(fields) == 0 {
-			return []string{fmt.Sprintf("%v", v)}, true, nil
-		}
-		return nil, false, nil
+		return results
 	default:
-		return nil, false, nil
+		return nil
 	}
 }
 
-// matchCondition 检查数组中的元素是否符合条件
-func matchCondition2(value interface{}, condition map[string]string) bool {
-	for key, val := range condition {
-		if valueMap, ok := value.(map[string]interface{}); ok {
-			if mapVal, exists := valueMap[key]; exists && fmt.Sprintf("%v", mapVal) == val {
-				continue
-			}
+// matchArrayFilter 检查数组中的元素是否符合[key=value]筛选条件
+func matchArrayFilter(value interface{}, filter map[string]string) bool {
+	valueMap, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for key, val := range filter {
+		if mapVal, exists := valueMap[key]; !exists || fmt.Sprintf("%v", mapVal) != val {
 			return false
 		}
 	}
@@ -0,0 +1,257 @@
+package callbacks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/weibaohui/kom/kom"
+	metatable "k8s.io/apimachinery/pkg/api/meta/table"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// tableAccept 请求api server以表格形式返回列表
+const tableAccept = "application/json;as=Table;v=v1;g=meta.k8s.io,application/json"
+
+// Table 按List的逻辑查询、过滤及排序对象，再转换为与 kubectl get 一致的表格
+// CRD按 additionalPrinterColumns 在本地计算，内置资源只请求一次api server返回的表格，表格行中带有完整对象，在本地过滤、排序及分页
+func Table(k *kom.Kubectl) error {
+	stmt := k.Statement
+	table, ok := stmt.Dest.(*kom.Table)
+	if !ok {
+		return fmt.Errorf("请传入 *kom.Table 类型")
+	}
+	if stmt.Filter.IsAggregate() || len(stmt.Filter.Joins) > 0 || stmt.Filter.Virtual != nil {
+		return fmt.Errorf("Table 不支持分组聚合、关联查询及虚拟表")
+	}
+
+	// 查询字段不影响表格的列
+	listStmt := *stmt
+	listStmt.Filter.Columns = nil
+	listStmt.Filter.Projections = nil
+	listStmt.Each = nil
+	tx := &kom.Kubectl{ID: k.ID, Statement: &listStmt}
+
+	if columns, ok := stmt.CRDPrinterColumns(); ok {
+		var items []unstructured.Unstructured
+		if err := tx.List(&items).Error; err != nil {
+			return err
+		}
+		stmt.RowsAffected = listStmt.RowsAffected
+		return fillCRDTable(table, columns, items)
+	}
+
+	definitions, items, cells, total, err := serverTable(tx)
+	if err != nil {
+		return err
+	}
+	// 已过滤的对象交给List排序及分页
+	listStmt.Items = items
+	var result []unstructured.Unstructured
+	if err = tx.List(&result).Error; err != nil {
+		return err
+	}
+	stmt.RowsAffected = int64(total)
+	fillServerTable(table, definitions, cells, result)
+	return nil
+}
+
+// fillCRDTable 按CRD的打印列计算每个对象的单元格
+func fillCRDTable(table *kom.Table, columns []kom.TableColumn, items []unstructured.Unstructured) error {
+	parsers := make([]*jsonpath.JSONPath, len(columns))
+	for i, c := range columns {
+		if c.JSONPath == "" {
+			continue
+		}
+		parser := jsonpath.New(c.Name).AllowMissingKeys(true)
+		if err := parser.Parse(fmt.Sprintf("{%s}", c.JSONPath)); err != nil {
+			return fmt.Errorf("printer column %s jsonPath %s error: %v", c.Name, c.JSONPath, err)
+		}
+		parsers[i] = parser
+	}
+
+	table.Columns = columns
+	table.Rows = make([]kom.TableRow, 0, len(items))
+	for _, item := range items {
+		cells := make([]interface{}, len(columns))
+		for i, c := range columns {
+			if parsers[i] == nil {
+				// 名称列
+				cells[i] = item.GetName()
+				continue
+			}
+			cells[i] = printerColumnCell(parsers[i], c.Type, item.Object)
+		}
+		table.Rows = append(table.Rows, kom.TableRow{Namespace: item.GetNamespace(), Name: item.GetName(), Cells: cells})
+	}
+	return nil
+}
+
+// printerColumnCell 计算打印列的值，与api server对CRD的处理一致，只取第一个值
+func printerColumnCell(parser *jsonpath.JSONPath, typ string, obj map[string]interface{}) interface{} {
+	results, err := parser.FindResults(obj)
+	if err != nil || len(results) == 0 || len(results[0]) == 0 {
+		return nil
+	}
+	value := results[0][0].Interface()
+	if typ == "string" {
+		var buf bytes.Buffer
+		if err := parser.PrintResults(&buf, []reflect.Value{reflect.ValueOf(value)}); err != nil {
+			return nil
+		}
+		return buf.String()
+	}
+	return tableCell(typ, value)
+}
+
+// tableCell 按列的类型转换单元格的值，类型不符时为nil
+func tableCell(typ string, value interface{}) interface{} {
+	switch typ {
+	case "integer":
+		switch v := value.(type) {
+		case int64:
+			return v
+		case float64:
+			return int64(v)
+		case int:
+			return int64(v)
+		}
+	case "number":
+		switch v := value.(type) {
+		case float64:
+			return v
+		case int64:
+			return float64(v)
+		case int:
+			return float64(v)
+		}
+	case "boolean":
+		if v, ok := value.(bool); ok {
+			return v
+		}
+	case "date":
+		if v, ok := value.(string); ok {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil
+			}
+			return metatable.ConvertToHumanReadableDateType(metav1.NewTime(t))
+		}
+	default:
+		if value == nil {
+			return nil
+		}
+		if v, ok := value.(string); ok {
+			return v
+		}
+		return fmt.Sprint(value)
+	}
+	return nil
+}
+
+// fillServerTable 按排序后的对象顺序填充api server返回的表格行
+func fillServerTable(table *kom.Table, definitions []metav1.TableColumnDefinition, cells map[types.UID][]interface{}, items []unstructured.Unstructured) {
+	table.Columns = make([]kom.TableColumn, 0, len(definitions))
+	for _, d := range definitions {
+		table.Columns = append(table.Columns, kom.TableColumn{
+			Name:        d.Name,
+			Type:        d.Type,
+			Format:      d.Format,
+			Description: d.Description,
+			Priority:    d.Priority,
+		})
+	}
+	table.Rows = make([]kom.TableRow, 0, len(items))
+	for _, item := range items {
+		table.Rows = append(table.Rows, kom.TableRow{Namespace: item.GetNamespace(), Name: item.GetName(), Cells: cells[item.GetUID()]})
+	}
+}
+
+// serverTable 按List相同的命名空间、selector请求api server返回表格，表格行中带有完整对象
+// 返回列定义、满足where条件的对象、按对象UID索引的单元格及查询到的对象总数
+func serverTable(k *kom.Kubectl) ([]metav1.TableColumnDefinition, []unstructured.Unstructured, map[types.UID][]interface{}, int, error) {
+	stmt := k.Statement
+	whereExpr, pushDown, listOptions, err := prepareList(k)
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+	paged := listOptions.Limit == 0 && listOptions.Continue == ""
+	if paged {
+		listOptions.Limit = stmt.PageSize
+		if listOptions.Limit <= 0 {
+			listOptions.Limit = kom.DefaultPageSize
+		}
+	}
+
+	var definitions []metav1.TableColumnDefinition
+	items := make([]unstructured.Unstructured, 0)
+	cells := make(map[types.UID][]interface{})
+	total := 0
+	client := stmt.Kubectl.Client().Discovery().RESTClient()
+	for _, ns := range stmt.ListNamespaces(pushDown) {
+		opt := listOptions
+		for {
+			raw, err := client.Get().
+				AbsPath(tablePath(stmt, ns)).
+				SetHeader("Accept", tableAccept).
+				SpecificallyVersionedParams(&opt, scheme.ParameterCodec, metav1.Unversioned).
+				Param("includeObject", string(metav1.IncludeObject)).
+				Do(stmt.Context).Raw()
+			if err != nil {
+				return nil, nil, nil, 0, err
+			}
+			var table metav1.Table
+			if err = json.Unmarshal(raw, &table); err != nil {
+				return nil, nil, nil, 0, err
+			}
+			if table.Kind != "Table" {
+				return nil, nil, nil, 0, fmt.Errorf("api server does not support table output for %s", stmt.GVR.String())
+			}
+			definitions = table.ColumnDefinitions
+			total += len(table.Rows)
+			for _, row := range table.Rows {
+				// 整数解析为int64，与List返回的对象一致
+				obj := unstructured.Unstructured{}
+				if err = utiljson.Unmarshal(row.Object.Raw, &obj.Object); err != nil {
+					return nil, nil, nil, 0, err
+				}
+				if whereExpr != nil && !evaluateExpr(obj, whereExpr) {
+					continue
+				}
+				for i := range row.Cells {
+					// JSON中的数字为float64，integer列转换为int64，date列已是 5d 形式的字符串
+					if i < len(definitions) && definitions[i].Type == "integer" {
+						row.Cells[i] = tableCell(definitions[i].Type, row.Cells[i])
+					}
+				}
+				items = append(items, obj)
+				cells[obj.GetUID()] = row.Cells
+			}
+			if !paged || table.Continue == "" {
+				break
+			}
+			opt.Continue = table.Continue
+		}
+	}
+	return definitions, items, cells, total, nil
+}
+
+// tablePath 资源列表的请求路径
+func tablePath(stmt *kom.Statement, ns string) string {
+	gvr := stmt.GVR
+	path := "/apis/" + gvr.Group + "/" + gvr.Version
+	if gvr.Group == "" {
+		path = "/api/" + gvr.Version
+	}
+	if stmt.Namespaced && ns != "" {
+		path += "/namespaces/" + ns
+	}
+	return path + "/" + gvr.Resource
+}
@@ -26,15 +26,16 @@ func Update(k *kom.Kubectl) error {
 	unstructuredObj.SetUnstructuredContent(unstructuredData)
 
 	var res *unstructured.Unstructured
+	updateOptions := metav1.UpdateOptions{DryRun: stmt.DryRunOptions()}
 
 	if namespaced {
 		if ns == "" {
 			ns = metav1.NamespaceDefault
 		}
 		unstructuredObj.SetNamespace(ns)
-		res, err = stmt.Kubectl.DynamicClient().Resource(gvr).Namespace(ns).Update(ctx, unstructuredObj, metav1.UpdateOptions{})
+		res, err = stmt.Kubectl.DynamicClient().Resource(gvr).Namespace(ns).Update(ctx, unstructuredObj, updateOptions)
 	} else {
-		res, err = stmt.Kubectl.DynamicClient().Resource(gvr).Update(ctx, unstructuredObj, metav1.UpdateOptions{})
+		res, err = stmt.Kubectl.DynamicClient().Resource(gvr).Update(ctx, unstructuredObj, updateOptions)
 	}
 
 	if err != nil {
@@ -3,9 +3,12 @@ package callbacks
 import (
 	"fmt"
 	"reflect"
+	"sync"
 
 	"github.com/weibaohui/kom/kom"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
@@ -14,9 +17,7 @@ func Watch(k *kom.Kubectl) error {
 	stmt := k.Statement
 	gvr := stmt.GVR
 	namespaced := stmt.Namespaced
-	ns := stmt.Namespace
 	ctx := stmt.Context
-	namespaceList := stmt.NamespaceList
 
 	opts := stmt.ListOptions
 	listOptions := metav1.ListOptions{}
@@ -36,21 +37,26 @@ func Watch(k *kom.Kubectl) error {
 		return fmt.Errorf("stmt.Dest 必须实现 watch.Interface 接口")
 	}
 
-	var watcher watch.Interface
-	var err error
+	if stmt.Filter.Virtual != nil || len(stmt.Filter.Joins) > 0 {
+		return fmt.Errorf("Watch 不支持虚拟表及关联查询")
+	}
 
+	// 执行条件中的子查询，能下推的条件转换为label、field selector
+	whereExpr, err := stmt.ResolveSubqueries(stmt.Filter.WhereExpr)
+	if err != nil {
+		return err
+	}
+	pushDown := stmt.PushDownWhere(whereExpr)
+	listOptions = pushDown.ApplyTo(listOptions)
+
+	var watcher watch.Interface
 	if namespaced {
-		if stmt.AllNamespace || len(namespaceList) > 1 {
-			// 全部命名空间 或者  传入多个命名空间
-			// client-go 不支持跨命名空间查询，就全部查出来，后面再过滤
-			ns = metav1.NamespaceAll
-		} else {
-			// 不是全部，也没有传多个命名空间
-			if ns == "" {
-				ns = metav1.NamespaceDefault
-			}
+		// client-go 不支持跨命名空间watch，只有一个命名空间时watch该命名空间，否则watch全部命名空间，再按条件过滤
+		namespaces := stmt.ListNamespaces(pushDown)
+		ns := metav1.NamespaceAll
+		if len(namespaces) == 1 {
+			ns = namespaces[0]
 		}
-
 		watcher, err = stmt.Kubectl.DynamicClient().Resource(gvr).Namespace(ns).Watch(ctx, listOptions)
 	} else {
 		watcher, err = stmt.Kubectl.DynamicClient().Resource(gvr).Watch(ctx, listOptions)
@@ -58,9 +64,99 @@ func Watch(k *kom.Kubectl) error {
 	if err != nil {
 		return err
 	}
+	if whereExpr != nil {
+		// 按where条件过滤事件，Namespace(a,b) 也会转换为where条件
+		watcher = newFilterWatcher(watcher, whereExpr)
+	}
 
 	// 将 watch 赋值给 dest
 	destValue.Elem().Set(reflect.ValueOf(watcher))
 
 	return nil
 }
+
+// filterWatcher 按where条件过滤watch事件，条件与List使用相同的求值逻辑
+// 对象从不满足变为满足条件时发送Added，从满足变为不满足时发送Deleted，事件中的对象为变化后的对象
+type filterWatcher struct {
+	source   watch.Interface
+	expr     *kom.ConditionExpr
+	result   chan watch.Event
+	stop     chan struct{}
+	stopOnce sync.Once
+	matched  map[types.UID]bool // 已发送给调用方、当前满足条件的对象
+}
+
+func newFilterWatcher(source watch.Interface, expr *kom.ConditionExpr) *filterWatcher {
+	w := &filterWatcher{
+		source:  source,
+		expr:    expr,
+		result:  make(chan watch.Event),
+		stop:    make(chan struct{}),
+		matched: make(map[types.UID]bool),
+	}
+	go w.run()
+	return w
+}
+
+func (w *filterWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+		w.source.Stop()
+	})
+}
+
+func (w *filterWatcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *filterWatcher) run() {
+	defer close(w.result)
+	for {
+		select {
+		case <-w.stop:
+			return
+		case event, ok := <-w.source.ResultChan():
+			if !ok {
+				return
+			}
+			event, ok = w.filter(event)
+			if !ok {
+				continue
+			}
+			select {
+			case w.result <- event:
+			case <-w.stop:
+				return
+			}
+		}
+	}
+}
+
+// filter 判断事件是否需要发送，并按对象是否满足条件的变化转换事件类型
+func (w *filterWatcher) filter(event watch.Event) (watch.Event, bool) {
+	if event.Type == watch.Bookmark || event.Type == watch.Error {
+		return event, true
+	}
+	obj, ok := event.Object.(*unstructured.Unstructured)
+	if !ok {
+		return event, true
+	}
+	uid := obj.GetUID()
+	prev := w.matched[uid]
+	match := evaluateExpr(*obj, w.expr)
+
+	if event.Type == watch.Deleted {
+		// 指定了resourceVersion时可能没有收到过该对象，删除时满足条件的也发送
+		delete(w.matched, uid)
+		return event, prev || match
+	}
+	switch {
+	case match && !prev:
+		w.matched[uid] = true
+		return watch.Event{Type: watch.Added, Object: obj}, true
+	case !match && prev:
+		delete(w.matched, uid)
+		return watch.Event{Type: watch.Deleted, Object: obj}, true
+	}
+	return event, match
+}
@@ -0,0 +1,85 @@
+package example
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/weibaohui/kom/kom"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServerSideApplyConflict(t *testing.T) {
+	name := "kom-ssa-test"
+	_ = kom.DefaultCluster().Resource(&corev1.ConfigMap{}).Namespace("default").Name(name).Delete().Error
+	defer kom.DefaultCluster().Resource(&corev1.ConfigMap{}).Namespace("default").Name(name).Delete()
+
+	cm := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Data:       map[string]string{"owner": "a"},
+	}
+	err := kom.DefaultCluster().Resource(&cm).ServerSideApply(&cm, "manager-a", false).Error
+	if err != nil {
+		t.Fatalf("ServerSideApply error %v", err)
+	}
+	if cm.UID == "" {
+		t.Fatalf("ServerSideApply should fill the object returned by api server")
+	}
+
+	// 其他field manager修改同一字段，冲突
+	other := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Data:       map[string]string{"owner": "b"},
+	}
+	err = kom.DefaultCluster().Resource(&other).ServerSideApply(&other, "manager-b", false).Error
+	if err == nil {
+		t.Fatalf("ServerSideApply without force should conflict")
+	}
+	conflicts := kom.ApplyConflicts(err)
+	if len(conflicts) == 0 {
+		t.Fatalf("ApplyConflicts returned no conflicts for %v", err)
+	}
+	for _, c := range conflicts {
+		t.Logf("conflict field=%s manager=%s", c.Field, c.Manager)
+		if c.Manager != "manager-a" {
+			t.Errorf("conflict manager = %s, want manager-a", c.Manager)
+		}
+	}
+
+	// 强制接管
+	err = kom.DefaultCluster().Resource(&other).ServerSideApply(&other, "manager-b", true).Error
+	if err != nil {
+		t.Fatalf("ServerSideApply with force error %v", err)
+	}
+	if other.Data["owner"] != "b" {
+		t.Errorf("owner = %s, want b", other.Data["owner"])
+	}
+}
+
+func TestApplierServerSide(t *testing.T) {
+	yaml := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: kom-ssa-applier-test
+data:
+  k: v1
+`
+	defer kom.DefaultCluster().Applier().Delete(yaml)
+
+	results := kom.DefaultCluster().Applier().ServerSide("manager-a", false).ApplyResults(yaml)
+	if len(results) != 1 || results[0].Error != nil {
+		t.Fatalf("ApplyResults = %v", results)
+	}
+	t.Logf("%s", results[0].String())
+
+	conflicting := strings.Replace(yaml, "k: v1", "k: v2", 1)
+	results = kom.DefaultCluster().Applier().ServerSide("manager-b", false).ApplyResults(conflicting)
+	if len(results) != 1 || len(results[0].Conflicts) == 0 {
+		t.Fatalf("ApplyResults should return conflicts, got %v", results)
+	}
+
+	result := kom.DefaultCluster().Applier().ServerSide("manager-b", true).Apply(conflicting)
+	if len(result) != 1 || !strings.HasSuffix(result[0], "serverside-applied") {
+		t.Fatalf("Apply with force = %v", result)
+	}
+}
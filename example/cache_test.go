@@ -0,0 +1,80 @@
+package example
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weibaohui/kom/kom"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestCacheInvalidateOnWrite(t *testing.T) {
+	name := "kom-cache-test"
+	cm := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": name}},
+		Data:       map[string]string{"k": "v1"},
+	}
+	_ = kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).Delete().Error
+	err := kom.DefaultCluster().Resource(&cm).Create(&cm).Error
+	if err != nil {
+		t.Fatalf("Create error %v", err)
+	}
+	defer kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).Delete()
+
+	// 写入缓存
+	var cached corev1.ConfigMap
+	err = kom.DefaultCluster().Resource(&cached).Namespace("default").Name(name).WithCache(time.Minute).Get(&cached).Error
+	if err != nil {
+		t.Fatalf("Get error %v", err)
+	}
+	var list []corev1.ConfigMap
+	err = kom.DefaultCluster().Resource(&corev1.ConfigMap{}).Namespace("default").WithLabelSelector("app=" + name).WithCache(time.Minute).List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("List returned %d items, want 1", len(list))
+	}
+
+	// 不同的label selector不共用缓存
+	err = kom.DefaultCluster().Resource(&corev1.ConfigMap{}).Namespace("default").WithLabelSelector("app=kom-cache-none").WithCache(time.Minute).List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	if len(list) != 0 {
+		t.Errorf("List with another label selector returned %d items, want 0", len(list))
+	}
+
+	// 更新后缓存失效，读取到新的值
+	cached.Data["k"] = "v2"
+	err = kom.DefaultCluster().Resource(&cached).Update(&cached).Error
+	if err != nil {
+		t.Fatalf("Update error %v", err)
+	}
+	var got corev1.ConfigMap
+	err = kom.DefaultCluster().Resource(&got).Namespace("default").Name(name).WithCache(time.Minute).Get(&got).Error
+	if err != nil {
+		t.Fatalf("Get error %v", err)
+	}
+	if got.Data["k"] != "v2" {
+		t.Errorf("Get after Update returned %s, want v2", got.Data["k"])
+	}
+
+	// 删除后列表缓存失效
+	err = kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).Delete().Error
+	if err != nil {
+		t.Fatalf("Delete error %v", err)
+	}
+	err = kom.DefaultCluster().Resource(&corev1.ConfigMap{}).Namespace("default").WithLabelSelector("app=" + name).WithCache(time.Minute).List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	if len(list) != 0 {
+		t.Errorf("List after Delete returned %d items, want 0", len(list))
+	}
+
+	// 手动清除缓存
+	kom.DefaultCluster().Tools().InvalidateCache(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, "default")
+}
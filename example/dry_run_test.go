@@ -0,0 +1,135 @@
+package example
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/weibaohui/kom/kom"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDryRun(t *testing.T) {
+	name := "kom-dry-run-test"
+	cm := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Data:       map[string]string{"k": "v1"},
+	}
+	_ = kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).Delete().Error
+
+	// 试运行创建，返回api server将要保存的对象，但不持久化
+	err := kom.DefaultCluster().Resource(&cm).DryRun().Create(&cm).Error
+	if err != nil {
+		t.Fatalf("DryRun Create error %v", err)
+	}
+	if cm.CreationTimestamp.IsZero() {
+		t.Errorf("DryRun Create should return the object from api server")
+	}
+	var got corev1.ConfigMap
+	err = kom.DefaultCluster().Resource(&got).Namespace("default").Name(name).Get(&got).Error
+	if err == nil {
+		t.Fatalf("DryRun Create should not persist %s", name)
+	}
+
+	cm = corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Data:       map[string]string{"k": "v1"},
+	}
+	err = kom.DefaultCluster().Resource(&cm).Create(&cm).Error
+	if err != nil {
+		t.Fatalf("Create error %v", err)
+	}
+	defer kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).Delete()
+
+	// 试运行更新、删除
+	cm.Data["k"] = "v2"
+	err = kom.DefaultCluster().Resource(&cm).DryRun().Update(&cm).Error
+	if err != nil {
+		t.Fatalf("DryRun Update error %v", err)
+	}
+	if cm.Data["k"] != "v2" {
+		t.Errorf("DryRun Update returned k=%s, want v2", cm.Data["k"])
+	}
+	err = kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).DryRun().Delete().Error
+	if err != nil {
+		t.Fatalf("DryRun Delete error %v", err)
+	}
+	err = kom.DefaultCluster().Resource(&got).Namespace("default").Name(name).Get(&got).Error
+	if err != nil {
+		t.Fatalf("DryRun Delete should not delete %s: %v", name, err)
+	}
+	if got.Data["k"] != "v1" {
+		t.Errorf("DryRun Update should not persist, k=%s", got.Data["k"])
+	}
+
+	// Applier 试运行
+	yaml := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: kom-dry-run-applier-test
+data:
+  k: v1
+`
+	results := kom.DefaultCluster().DryRun().Applier().Apply(yaml)
+	if len(results) != 1 || !strings.HasSuffix(results[0], "(server dry run)") {
+		t.Fatalf("DryRun Apply = %v", results)
+	}
+	err = kom.DefaultCluster().Resource(&got).Namespace("default").Name("kom-dry-run-applier-test").Get(&got).Error
+	if err == nil {
+		t.Fatalf("DryRun Apply should not persist kom-dry-run-applier-test")
+	}
+}
+
+func TestDryRunSqlExec(t *testing.T) {
+	name := "kom-dry-run-sql-test"
+	cm := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"komsql": "dryrun"}},
+		Data:       map[string]string{"env": "prod"},
+	}
+	_ = kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).Delete().Error
+	err := kom.DefaultCluster().Resource(&cm).Create(&cm).Error
+	if err != nil {
+		t.Fatalf("Create error %v", err)
+	}
+	defer kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).Delete()
+
+	// 记录逐个对象执行Patch、Delete时的DryRun参数
+	var dryRunOptions [][]string
+	record := func(k *kom.Kubectl) error {
+		if k.Statement.Name == name {
+			dryRunOptions = append(dryRunOptions, k.Statement.DryRunOptions())
+		}
+		return nil
+	}
+	cb := kom.DefaultCluster().Callback()
+	_ = cb.Patch().Before("kom:patch").Register("test:dry_run:patch", record)
+	_ = cb.Delete().Before("kom:delete").Register("test:dry_run:delete", record)
+	defer cb.Patch().Remove("test:dry_run:patch")
+	defer cb.Delete().Remove("test:dry_run:delete")
+
+	err = kom.DefaultCluster().DryRun().Sql("update configmap set data.env='dev' where metadata.labels.komsql='dryrun'").Exec(nil).Error
+	if err != nil {
+		t.Fatalf("DryRun Sql update error %v", err)
+	}
+	err = kom.DefaultCluster().DryRun().Sql("delete from configmap where metadata.labels.komsql='dryrun'").Exec(nil).Error
+	if err != nil {
+		t.Fatalf("DryRun Sql delete error %v", err)
+	}
+	if len(dryRunOptions) != 2 {
+		t.Fatalf("expected patch and delete callbacks, got %v", dryRunOptions)
+	}
+	for _, opt := range dryRunOptions {
+		if len(opt) != 1 || opt[0] != metav1.DryRunAll {
+			t.Errorf("DryRunOptions = %v, want [%s]", opt, metav1.DryRunAll)
+		}
+	}
+
+	var got corev1.ConfigMap
+	err = kom.DefaultCluster().Resource(&got).Namespace("default").Name(name).Get(&got).Error
+	if err != nil {
+		t.Fatalf("DryRun Sql delete should not delete %s: %v", name, err)
+	}
+	if got.Data["env"] != "prod" {
+		t.Errorf("DryRun Sql update should not persist, env=%s", got.Data["env"])
+	}
+}
@@ -0,0 +1,64 @@
+package example
+
+import (
+	"testing"
+
+	"github.com/weibaohui/kom/kom"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestInformerCache(t *testing.T) {
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	informer := kom.DefaultCluster().InformerCache()
+	informer.Enable(gvr)
+	defer informer.Disable()
+
+	// 首次查询等待informer同步，之后从informer中读取
+	var list []corev1.Pod
+	err := kom.DefaultCluster().Resource(&corev1.Pod{}).Namespace("kube-system").List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	if !informer.HasSynced(gvr) {
+		t.Errorf("pods informer should be synced")
+	}
+	for _, d := range list {
+		if d.Namespace != "kube-system" {
+			t.Errorf("pod %s/%s is not in kube-system", d.Namespace, d.Name)
+		}
+	}
+
+	// label、field selector 在informer中本地匹配
+	err = kom.DefaultCluster().Sql("select * from pod where metadata.labels.k8s-app='kube-dns' and status.phase='Running'").List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		if d.Labels["k8s-app"] != "kube-dns" || d.Status.Phase != corev1.PodRunning {
+			t.Errorf("pod %s/%s does not match", d.Namespace, d.Name)
+		}
+	}
+
+	// Get 从informer中读取
+	if len(list) > 0 {
+		var pod corev1.Pod
+		err = kom.DefaultCluster().Resource(&pod).Namespace(list[0].Namespace).Name(list[0].Name).Get(&pod).Error
+		if err != nil {
+			t.Fatalf("Get error %v", err)
+		}
+		if pod.Name != list[0].Name {
+			t.Errorf("Get returned %s, want %s", pod.Name, list[0].Name)
+		}
+	}
+
+	// 执行计划中显示使用informer缓存
+	var plan kom.ExplainPlan
+	err = kom.DefaultCluster().Sql("select * from pod").Explain(&plan).Error
+	if err != nil {
+		t.Fatalf("Explain error %v", err)
+	}
+	if !plan.Informer {
+		t.Errorf("explain should use informer")
+	}
+}
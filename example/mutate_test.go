@@ -0,0 +1,78 @@
+package example
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/weibaohui/kom/kom"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestMutateRetryOnConflict(t *testing.T) {
+	name := "kom-mutate-test"
+	cm := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Data:       map[string]string{"count": "0"},
+	}
+	_ = kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).Delete().Error
+	err := kom.DefaultCluster().Resource(&cm).Create(&cm).Error
+	if err != nil {
+		t.Fatalf("Create error %v", err)
+	}
+	defer kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).Delete()
+
+	// 并发修改同一对象，冲突时重新读取并重试，每次修改都不会丢失
+	workers := 3
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var item corev1.ConfigMap
+			err := kom.DefaultCluster().Resource(&item).Namespace("default").Name(name).
+				Mutate(&item, func(obj interface{}) error {
+					c := obj.(*corev1.ConfigMap)
+					n, err := strconv.Atoi(c.Data["count"])
+					if err != nil {
+						return err
+					}
+					c.Data["count"] = strconv.Itoa(n + 1)
+					return nil
+				}).Error
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Mutate error %v", err)
+		}
+	}
+
+	// unstructured 对象
+	var item unstructured.Unstructured
+	err = kom.DefaultCluster().CRD("", "v1", "ConfigMap").Namespace("default").Name(name).
+		Mutate(&item, func(obj interface{}) error {
+			return unstructured.SetNestedField(obj.(*unstructured.Unstructured).Object, "done", "data", "state")
+		}).Error
+	if err != nil {
+		t.Fatalf("Mutate unstructured error %v", err)
+	}
+
+	var got corev1.ConfigMap
+	err = kom.DefaultCluster().Resource(&got).Namespace("default").Name(name).Get(&got).Error
+	if err != nil {
+		t.Fatalf("Get error %v", err)
+	}
+	if got.Data["count"] != strconv.Itoa(workers) {
+		t.Errorf("count = %s, want %d", got.Data["count"], workers)
+	}
+	if got.Data["state"] != "done" {
+		t.Errorf("state = %s, want done", got.Data["state"])
+	}
+}
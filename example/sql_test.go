@@ -1,10 +1,16 @@
 package example
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/weibaohui/kom/kom"
+	"github.com/weibaohui/kom/utils"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -143,3 +149,776 @@ func TestCRD2Sql(t *testing.T) {
 		t.Logf("List Items foreach %s,%s\n", d.GetNamespace(), d.GetName())
 	}
 }
+func TestNestedParenSql(t *testing.T) {
+	// 括号内的OR条件作为一个整体，与外层条件进行AND运算
+	sql := "select * from pod where metadata.namespace='kube-system' and (metadata.name like 'coredns%' or metadata.name like 'etcd%') and not (status.phase='Failed')"
+
+	var list []v1.Pod
+	err := kom.DefaultCluster().Sql(sql).List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		if d.GetNamespace() != "kube-system" {
+			t.Errorf("expected namespace kube-system, got %s/%s", d.GetNamespace(), d.GetName())
+		}
+		if !strings.HasPrefix(d.GetName(), "coredns") && !strings.HasPrefix(d.GetName(), "etcd") {
+			t.Errorf("unexpected pod %s/%s", d.GetNamespace(), d.GetName())
+		}
+	}
+	t.Logf("Count %d", len(list))
+}
+func TestSelectColumnsSql(t *testing.T) {
+	sql := "select metadata.name as name, metadata.namespace as namespace, status.phase, spec.nodeName from pod where metadata.namespace='kube-system'"
+
+	var rows []map[string]interface{}
+	err := kom.DefaultCluster().Sql(sql).List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, row := range rows {
+		t.Logf("%s/%s phase=%v node=%v", row["namespace"], row["name"], row["status.phase"], row["spec.nodeName"])
+	}
+
+	// 使用结构体承载，按json tag 对应字段名或别名
+	type podRow struct {
+		Name  string `json:"name"`
+		Phase string `json:"status.phase"`
+	}
+	var list []podRow
+	err = kom.DefaultCluster().From("pod").
+		Select("metadata.name as name", "status.phase").
+		Where("metadata.namespace=?", "kube-system").
+		List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		t.Logf("%s phase=%s", d.Name, d.Phase)
+	}
+}
+func TestGroupBySql(t *testing.T) {
+	// 统计每个节点上的pod数量
+	sql := "select spec.nodeName as node, count(*) as total from pod group by spec.nodeName having count(*) > 0 order by total desc"
+
+	var rows []map[string]interface{}
+	err := kom.DefaultCluster().Sql(sql).List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, row := range rows {
+		t.Logf("node=%v total=%v", row["node"], row["total"])
+	}
+
+	// 统计每个命名空间下容器重启次数之和
+	type nsRestart struct {
+		Namespace string `json:"namespace"`
+		Restarts  int64  `json:"restarts"`
+	}
+	var list []nsRestart
+	err = kom.DefaultCluster().From("pod").
+		Select("metadata.namespace as namespace", "sum(status.containerStatuses.restartCount) as restarts").
+		GroupBy("metadata.namespace").
+		List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		t.Logf("namespace=%s restarts=%d", d.Namespace, d.Restarts)
+	}
+}
+func TestNumberConditionSql(t *testing.T) {
+	// = 1 与布尔字段比较时按布尔值匹配，与 = true 一致
+	var byNumber, byBool []v1.Pod
+	err := kom.DefaultCluster().Sql("select * from pod where spec.hostNetwork=1").List(&byNumber).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	err = kom.DefaultCluster().Sql("select * from pod where spec.hostNetwork=true").List(&byBool).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	if len(byNumber) != len(byBool) {
+		t.Errorf("spec.hostNetwork=1 returned %d pods, =true returned %d", len(byNumber), len(byBool))
+	}
+
+	// 大小比较时 1、0 按数字比较
+	tx := kom.DefaultCluster().From("pod").Where("spec.priority > 1")
+	if cond := tx.Statement.Filter.WhereExpr.Condition; cond == nil || cond.ValueType != utils.TypeNumber || cond.Value != 1.0 {
+		t.Errorf("spec.priority > 1 should compare as number, got %+v", cond)
+	}
+	var rows []map[string]interface{}
+	err = kom.DefaultCluster().Sql("select metadata.namespace as ns, count(*) as total from pod group by metadata.namespace having count(*) > 1").List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, row := range rows {
+		var total float64
+		switch v := row["total"].(type) {
+		case int64:
+			total = float64(v)
+		case float64:
+			total = v
+		}
+		if total <= 1 {
+			t.Errorf("having count(*) > 1 returned %v", row)
+		}
+	}
+}
+func TestMultiOrderBySql(t *testing.T) {
+	sql := "select * from pod order by metadata.namespace asc, metadata.creationTimestamp desc, spec.nodeName asc nulls first limit 20"
+
+	var list []v1.Pod
+	err := kom.DefaultCluster().Sql(sql).List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for i := 1; i < len(list); i++ {
+		prev, cur := list[i-1], list[i]
+		if prev.GetNamespace() > cur.GetNamespace() {
+			t.Errorf("namespace not sorted asc: %s > %s", prev.GetNamespace(), cur.GetNamespace())
+		}
+		if prev.GetNamespace() == cur.GetNamespace() && prev.CreationTimestamp.Before(&cur.CreationTimestamp) {
+			t.Errorf("creationTimestamp not sorted desc in %s: %s < %s", cur.GetNamespace(), prev.GetName(), cur.GetName())
+		}
+	}
+}
+func TestJoinSql(t *testing.T) {
+	// 查询pod及其所在节点的kubelet版本
+	sql := "select p.metadata.name as pod, n.metadata.name as node, `n.status.nodeInfo.kubeletVersion` as kubelet from pod p join node n on p.spec.nodeName = n.metadata.name"
+
+	var rows []map[string]interface{}
+	err := kom.DefaultCluster().Sql(sql).List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, row := range rows {
+		if row["node"] == nil {
+			t.Errorf("inner join row without node: %v", row)
+		}
+		t.Logf("pod=%v node=%v kubelet=%v", row["pod"], row["node"], row["kubelet"])
+	}
+
+	// left join 未匹配时保留pod，关联表字段为nil
+	sql = "select p.metadata.name as pod, rs.metadata.name as rs from pod p left join replicaset rs on `p.metadata.ownerReferences.uid` = rs.metadata.uid"
+	err = kom.DefaultCluster().Sql(sql).List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, row := range rows {
+		t.Logf("pod=%v rs=%v", row["pod"], row["rs"])
+	}
+
+	// 关联字段的值只有大小写不同时，与where中的=一致可以关联
+	team := v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kom-join-team", Namespace: "default"},
+		Data:       map[string]string{"team": "Platform"},
+	}
+	member := v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kom-join-member", Namespace: "default", Labels: map[string]string{"komjoin": "platform"}},
+	}
+	for _, cm := range []*v1.ConfigMap{&team, &member} {
+		_ = kom.DefaultCluster().Resource(cm).Namespace("default").Name(cm.Name).Delete().Error
+		if err = kom.DefaultCluster().Resource(cm).Create(cm).Error; err != nil {
+			t.Fatalf("ConfigMap Create error %v", err)
+		}
+		defer kom.DefaultCluster().Resource(&v1.ConfigMap{}).Namespace("default").Name(cm.Name).Delete()
+	}
+	sql = "select m.metadata.name as member, t.metadata.name as team from configmap m join configmap t on m.metadata.labels.komjoin = t.data.team where m.metadata.name = 'kom-join-member'"
+	err = kom.DefaultCluster().Sql(sql).List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	if len(rows) != 1 || rows[0]["team"] != "kom-join-team" {
+		t.Errorf("join on values differing in case = %v, want team kom-join-team", rows)
+	}
+}
+func TestSqlUpdateDelete(t *testing.T) {
+	for _, name := range []string{"kom-sql-dml-1", "kom-sql-dml-2"} {
+		cm := v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{"komsql": "dml"},
+			},
+		}
+		err := kom.DefaultCluster().Resource(&cm).Create(&cm).Error
+		if err != nil {
+			t.Fatalf("ConfigMap Create error %v", err)
+		}
+	}
+
+	// 预览匹配的对象，不执行修改
+	var results []kom.ExecResult
+	tx := kom.DefaultCluster().Sql("update configmap set data.env='dev' where metadata.labels.komsql='dml'").Preview().Exec(&results)
+	if tx.Error != nil {
+		t.Fatalf("Preview error %v", tx.Error)
+	}
+	if tx.Statement.RowsAffected != 2 || len(results) != 2 {
+		t.Fatalf("Preview expected 2 objects, got %d %v", tx.Statement.RowsAffected, results)
+	}
+
+	tx = kom.DefaultCluster().Sql("update configmap set data.env='dev' where metadata.labels.komsql='dml'").Exec(&results)
+	if tx.Error != nil {
+		t.Fatalf("Update error %v", tx.Error)
+	}
+	var cm v1.ConfigMap
+	err := kom.DefaultCluster().Resource(&cm).Namespace("default").Name("kom-sql-dml-1").Get(&cm).Error
+	if err != nil || cm.Data["env"] != "dev" {
+		t.Fatalf("Update not applied %v %v", cm.Data, err)
+	}
+
+	tx = kom.DefaultCluster().Sql("delete from configmap where metadata.labels.komsql='dml' and metadata.namespace='default'").Exec(&results)
+	if tx.Error != nil {
+		t.Fatalf("Delete error %v", tx.Error)
+	}
+	for _, r := range results {
+		t.Logf("deleted %s/%s", r.Namespace, r.Name)
+	}
+	if tx.Statement.RowsAffected != 2 {
+		t.Fatalf("Delete expected 2 rows affected, got %d", tx.Statement.RowsAffected)
+	}
+}
+func TestSqlUpdateFieldPath(t *testing.T) {
+	name := "kom-sql-set-path"
+	cm := v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{"komsql": "setpath"},
+		},
+	}
+	_ = kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).Delete().Error
+	err := kom.DefaultCluster().Resource(&cm).Create(&cm).Error
+	if err != nil {
+		t.Fatalf("ConfigMap Create error %v", err)
+	}
+	defer kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).Delete()
+
+	// [] 中的key作为一级，包含.、/ 的label key 不会被拆分
+	err = kom.DefaultCluster().Sql("update configmap set metadata.labels['app.kubernetes.io/name']='kom' where metadata.labels.komsql='setpath'").Exec(nil).Error
+	if err != nil {
+		t.Fatalf("Update error %v", err)
+	}
+	var got v1.ConfigMap
+	err = kom.DefaultCluster().Resource(&got).Namespace("default").Name(name).Get(&got).Error
+	if err != nil {
+		t.Fatalf("Get error %v", err)
+	}
+	if got.Labels["app.kubernetes.io/name"] != "kom" {
+		t.Errorf("label app.kubernetes.io/name = %q, want kom, labels %v", got.Labels["app.kubernetes.io/name"], got.Labels)
+	}
+
+	// 合并patch无法修改数组中的元素，数组下标、筛选直接报错
+	for _, sql := range []string{
+		"update pod set spec.containers[0].image='nginx:1.27' where metadata.name='x'",
+		"update pod set spec.containers[name=app].image='nginx:1.27' where metadata.name='x'",
+	} {
+		err = kom.DefaultCluster().Sql(sql).Exec(nil).Error
+		if err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+}
+func TestPushDownSql(t *testing.T) {
+	// metadata.namespace、status.phase 条件下推到api server执行，spec.priority 在本地过滤
+	sql := "select * from pod where metadata.namespace in ('kube-system','default') and status.phase='Running' and spec.priority>=0"
+
+	var list []v1.Pod
+	err := kom.DefaultCluster().Sql(sql).List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		if (d.Namespace != "kube-system" && d.Namespace != "default") || d.Status.Phase != v1.PodRunning {
+			t.Errorf("unexpected pod %s/%s %s", d.Namespace, d.Name, d.Status.Phase)
+		}
+	}
+
+	// 查看下推的条件
+	tx := kom.DefaultCluster().From("pod").Where("metadata.labels.tier='1' and spec.nodeName='node1'")
+	plan := tx.Statement.PushDownWhere(tx.Statement.Filter.WhereExpr)
+	if plan.LabelSelector != "tier=1" || plan.FieldSelector != "spec.nodeName=node1" || plan.Residual != nil {
+		t.Errorf("unexpected push down %+v", plan)
+	}
+
+	// = 不区分大小写，枚举值及小写字段转换为规范值下推，含字母的label值只下推key存在的条件
+	tx = kom.DefaultCluster().From("pod").Where("metadata.labels.app='Nginx' and status.phase='running' and spec.nodeName='Node1'")
+	plan = tx.Statement.PushDownWhere(tx.Statement.Filter.WhereExpr)
+	if plan.LabelSelector != "app" || plan.FieldSelector != "status.phase=Running,spec.nodeName=node1" {
+		t.Errorf("unexpected push down %+v", plan)
+	}
+	if plan.Residual == nil || plan.Residual.Condition == nil || plan.Residual.Condition.Field != "metadata.labels.app" {
+		t.Errorf("label value should be compared locally, residual %v", plan.Residual)
+	}
+
+	// 与下推前的结果一致
+	var lower, upper []v1.Pod
+	err = kom.DefaultCluster().Sql("select * from pod where status.phase='running'").List(&lower).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	err = kom.DefaultCluster().Sql("select * from pod where status.phase='Running'").List(&upper).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	if len(lower) != len(upper) {
+		t.Errorf("status.phase='running' returned %d pods, 'Running' returned %d", len(lower), len(upper))
+	}
+}
+func TestSqlBindValues(t *testing.T) {
+	// 参数在解析为语法树后绑定，包含引号的值不会改变查询条件
+	var list []v1.Pod
+	err := kom.DefaultCluster().From("pod").
+		Where("metadata.name like ?", "%x' or '1'='1%").
+		List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	if len(list) != 0 {
+		t.Errorf("expected no pods, got %d", len(list))
+	}
+
+	// 切片绑定到 in ?，数字、字符串按Go类型比较
+	err = kom.DefaultCluster().
+		Sql("select * from pod where metadata.namespace in ? and status.phase=? limit ?", []string{"kube-system", "default"}, v1.PodRunning, 10).
+		List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		t.Logf("List Items foreach %s,%s\n", d.GetNamespace(), d.GetName())
+	}
+
+	// 大小比较时绑定的字符串与字面量一样探测类型，日期按时间比较
+	var bound, literal []v1.Pod
+	err = kom.DefaultCluster().From("pod").Where("metadata.creationTimestamp > ?", "2024-11-08").List(&bound).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	err = kom.DefaultCluster().From("pod").Where("metadata.creationTimestamp > '2024-11-08'").List(&literal).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	if len(bound) != len(literal) {
+		t.Errorf("bound date returned %d pods, literal returned %d", len(bound), len(literal))
+	}
+	tx := kom.DefaultCluster().From("pod").Where("metadata.creationTimestamp > ?", "2024-11-08")
+	if cond := tx.Statement.Filter.WhereExpr.Condition; cond == nil || cond.ValueType != utils.TypeTime {
+		t.Errorf("bound date should compare as time, got %+v", cond)
+	}
+
+	// 占位符与参数数量不一致时返回错误
+	err = kom.DefaultCluster().Sql("select * from pod where metadata.name=?").List(&list).Error
+	if err == nil {
+		t.Errorf("expected placeholder count error")
+	}
+}
+func TestNullRegexpSql(t *testing.T) {
+	// 没有配置存活探针的pod
+	var list []v1.Pod
+	err := kom.DefaultCluster().Sql("select * from pod where spec.containers.livenessProbe is null").List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		for _, c := range d.Spec.Containers {
+			if c.LivenessProbe != nil {
+				t.Errorf("pod %s/%s has livenessProbe", d.Namespace, d.Name)
+			}
+		}
+	}
+
+	// 处于删除中的pod
+	err = kom.DefaultCluster().Sql("select * from pod where metadata.deletionTimestamp is not null").List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		if d.DeletionTimestamp == nil {
+			t.Errorf("pod %s/%s is not terminating", d.Namespace, d.Name)
+		}
+	}
+
+	// 正则匹配及 not like
+	err = kom.DefaultCluster().Sql("select * from pod where metadata.name regexp '^coredns-[a-z0-9]+' and metadata.namespace not like 'default%'").List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		if !strings.HasPrefix(d.Name, "coredns-") {
+			t.Errorf("unexpected pod %s", d.Name)
+		}
+	}
+
+	// 非法正则在解析时报错
+	err = kom.DefaultCluster().Sql("select * from pod where metadata.name regexp '[a-'").List(&list).Error
+	if err == nil {
+		t.Errorf("expected invalid regexp error")
+	}
+}
+func TestFieldPathSql(t *testing.T) {
+	sql := "select metadata.name as name, metadata.labels['kubernetes.io/hostname'] as host, status.addresses[type=InternalIP].address as ip from node order by metadata.labels['kubernetes.io/hostname']"
+
+	var rows []map[string]interface{}
+	err := kom.DefaultCluster().Sql(sql).List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, row := range rows {
+		t.Logf("node=%v host=%v ip=%v", row["name"], row["host"], row["ip"])
+	}
+
+	// 数组下标及全部元素
+	var list []v1.Pod
+	err = kom.DefaultCluster().From("pod").
+		Where("spec.containers[0].image like ? and spec.containers[*].name is not null", "%nginx%").
+		List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		if !strings.Contains(d.Spec.Containers[0].Image, "nginx") {
+			t.Errorf("unexpected image %s", d.Spec.Containers[0].Image)
+		}
+	}
+}
+func TestSubquerySql(t *testing.T) {
+	var nodes []v1.Node
+	err := kom.DefaultCluster().Resource(&v1.Node{}).List(&nodes).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	if len(nodes) == 0 {
+		t.Skip("no node")
+	}
+	node := nodes[0].Name
+
+	// 调度到指定节点上的pod
+	var list []v1.Pod
+	err = kom.DefaultCluster().Sql("select * from pod where spec.nodeName in (select metadata.name from node where metadata.name=?)", node).List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		if d.Spec.NodeName != node {
+			t.Errorf("pod %s/%s is on node %s", d.Namespace, d.Name, d.Spec.NodeName)
+		}
+	}
+
+	// 未被pod挂载的configmap
+	var cms []v1.ConfigMap
+	err = kom.DefaultCluster().Sql("select * from configmap where metadata.namespace='kube-system' and metadata.name not in (select spec.volumes.configMap.name from pod where metadata.namespace='kube-system')").List(&cms).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range cms {
+		t.Logf("unused configmap %s/%s", d.Namespace, d.Name)
+	}
+
+	// 子查询只能查询一个字段
+	err = kom.DefaultCluster().Sql("select * from pod where spec.nodeName in (select * from node)").List(&list).Error
+	if err == nil {
+		t.Errorf("expected subquery error")
+	}
+}
+func TestExplainSql(t *testing.T) {
+	sql := "select * from pod where metadata.namespace='kube-system' and status.phase='Running' and metadata.name like 'coredns%' order by metadata.name limit 10"
+	var plan kom.ExplainPlan
+	err := kom.DefaultCluster().Sql(sql).WithCache(time.Second * 5).Explain(&plan).Error
+	if err != nil {
+		t.Fatalf("Explain error %v", err)
+	}
+	t.Logf("GVR=%v scope=%s namespaces=%v", plan.GVR, plan.NamespaceScope, plan.Namespaces)
+	t.Logf("fieldSelector=%s pushed=%v residual=%s", plan.FieldSelector, plan.Pushed, plan.Residual)
+	t.Logf("orderBy=%v limit=%d cacheKey=%s cacheHit=%v", plan.OrderBy, plan.Limit, plan.CacheKey, plan.CacheHit)
+	if plan.GVR.Resource != "pods" {
+		t.Errorf("expected pods, got %s", plan.GVR.Resource)
+	}
+	if plan.FieldSelector != "status.phase=Running" {
+		t.Errorf("unexpected field selector %s", plan.FieldSelector)
+	}
+	if plan.Residual != "metadata.name like 'coredns%'" {
+		t.Errorf("unexpected residual %s", plan.Residual)
+	}
+
+	// 执行查询后再次获取执行计划，命中缓存
+	var list []v1.Pod
+	err = kom.DefaultCluster().Sql(sql).WithCache(time.Second * 5).List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	err = kom.DefaultCluster().Sql(sql).WithCache(time.Second * 5).Explain(&plan).Error
+	if err != nil {
+		t.Fatalf("Explain error %v", err)
+	}
+	if !plan.CacheHit {
+		t.Errorf("expected cache hit")
+	}
+
+	// explain 语句通过List返回执行计划
+	var rows []map[string]interface{}
+	err = kom.DefaultCluster().Sql("explain " + sql).List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 plan row, got %d", len(rows))
+	}
+	t.Logf("plan=%v", rows[0])
+}
+func TestRelativeTimeSql(t *testing.T) {
+	// 创建时间超过7天的pod
+	var list []v1.Pod
+	err := kom.DefaultCluster().Sql("select * from pod where metadata.creationTimestamp < now() - interval 7 day").List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		if time.Since(d.CreationTimestamp.Time) < 7*24*time.Hour {
+			t.Errorf("pod %s/%s created at %v", d.Namespace, d.Name, d.CreationTimestamp)
+		}
+	}
+
+	// age 与时长比较，按 age 排序
+	err = kom.DefaultCluster().Sql("select * from pod where age(metadata.creationTimestamp) > ? order by age(metadata.creationTimestamp) desc", 24*time.Hour).List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for i, d := range list {
+		if time.Since(d.CreationTimestamp.Time) < 24*time.Hour {
+			t.Errorf("pod %s/%s created at %v", d.Namespace, d.Name, d.CreationTimestamp)
+		}
+		if i > 0 && d.CreationTimestamp.Before(&list[i-1].CreationTimestamp) {
+			t.Errorf("pod %s/%s is not sorted by age", d.Namespace, d.Name)
+		}
+	}
+
+	// 最近一小时内完成的job
+	var jobs []map[string]interface{}
+	err = kom.DefaultCluster().Sql("select metadata.name, age(status.completionTime) as age from job where status.completionTime > now() - '1h'").List(&jobs).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, j := range jobs {
+		t.Logf("job %v completed %vs ago", j["metadata.name"], j["age"])
+	}
+}
+func TestQuantitySql(t *testing.T) {
+	// 请求内存超过64Mi的pod
+	var list []v1.Pod
+	err := kom.DefaultCluster().Sql("select * from pod where spec.containers.resources.requests.memory > '64Mi' order by spec.containers.resources.requests.memory desc").List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	limit := resource.MustParse("64Mi")
+	for _, d := range list {
+		matched := false
+		for _, c := range d.Spec.Containers {
+			if q, ok := c.Resources.Requests[v1.ResourceMemory]; ok && q.Cmp(limit) > 0 {
+				matched = true
+			}
+		}
+		if !matched {
+			t.Errorf("pod %s/%s does not request more than 64Mi", d.Namespace, d.Name)
+		}
+	}
+
+	// cpu 使用数字及绑定的 resource.Quantity 比较
+	err = kom.DefaultCluster().Sql("select * from pod where spec.containers.resources.requests.cpu >= ? and spec.containers.resources.requests.cpu < 2", resource.MustParse("100m")).List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		t.Logf("pod %s/%s", d.Namespace, d.Name)
+	}
+
+	// 按资源数量聚合
+	var rows []map[string]interface{}
+	err = kom.DefaultCluster().Sql("select metadata.namespace, sum(spec.containers.resources.requests.cpu) as cpu, max(spec.containers.resources.requests.memory) as memory from pod group by metadata.namespace").List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, row := range rows {
+		t.Logf("namespace=%v cpu=%v memory=%v", row["metadata.namespace"], row["cpu"], row["memory"])
+	}
+}
+func TestScalarFuncSql(t *testing.T) {
+	// 多容器的pod，按容器数量倒序
+	var list []v1.Pod
+	err := kom.DefaultCluster().Sql("select * from pod where len(spec.containers) > 1 order by len(spec.containers) desc").List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		if len(d.Spec.Containers) <= 1 {
+			t.Errorf("pod %s/%s has %d containers", d.Namespace, d.Name, len(d.Spec.Containers))
+		}
+	}
+
+	// 名称不区分大小写匹配，未设置副本数时按1计算
+	var rows []map[string]interface{}
+	err = kom.DefaultCluster().Sql("select metadata.name, coalesce(spec.replicas, 1) as replicas, split(metadata.name, '-', 0) as prefix from deploy where lower(metadata.name) like '%coredns%'").List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, row := range rows {
+		t.Logf("deploy %v replicas=%v prefix=%v", row["metadata.name"], row["replicas"], row["prefix"])
+	}
+
+	// 从注解中的JSON取值
+	err = kom.DefaultCluster().Sql(`select metadata.name, json_extract(json_extract(metadata.annotations, '$."kubectl.kubernetes.io/last-applied-configuration"'), '$.spec.replicas') as replicas from deploy`).List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, row := range rows {
+		t.Logf("deploy %v last applied replicas=%v", row["metadata.name"], row["replicas"])
+	}
+
+	// 自定义函数
+	kom.RegisterSqlFunc("trim_prefix", func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("trim_prefix requires 2 arguments")
+		}
+		return strings.TrimPrefix(fmt.Sprintf("%v", args[0]), fmt.Sprintf("%v", args[1])), nil
+	})
+	err = kom.DefaultCluster().Sql("select * from pod where metadata.namespace = 'kube-system' and trim_prefix(metadata.name, 'kube-') like 'proxy%'").List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, d := range list {
+		if !strings.HasPrefix(d.Name, "kube-proxy") {
+			t.Errorf("pod %s/%s does not match trim_prefix", d.Namespace, d.Name)
+		}
+	}
+
+	// 返回int、time.Time的自定义函数
+	kom.RegisterSqlFunc("name_len", func(args ...interface{}) (interface{}, error) {
+		return len(fmt.Sprintf("%v", args[0])), nil
+	})
+	kom.RegisterSqlFunc("created_at", func(args ...interface{}) (interface{}, error) {
+		t, err := time.Parse(time.RFC3339, fmt.Sprintf("%v", args[0]))
+		if err != nil {
+			return nil, nil
+		}
+		return t, nil
+	})
+	err = kom.DefaultCluster().Sql("select metadata.name, name_len(metadata.name) as n, created_at(metadata.creationTimestamp) as created from pod where name_len(metadata.name) > 3 order by created_at(metadata.creationTimestamp) desc").List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, row := range rows {
+		if _, ok := row["n"].(int64); !ok {
+			t.Errorf("name_len = %T %v, want int64", row["n"], row["n"])
+		}
+		if _, ok := row["created"].(string); !ok {
+			t.Errorf("created_at = %T %v, want string", row["created"], row["created"])
+		}
+	}
+	err = kom.DefaultCluster().Sql("select name_len(metadata.name) as n, count(*) as total from pod group by name_len(metadata.name)").List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, row := range rows {
+		t.Logf("name_len=%v total=%v", row["n"], row["total"])
+	}
+
+	// 未注册的函数
+	err = kom.DefaultCluster().Sql("select * from pod where unknown_func(metadata.name) = 'x'").List(&list).Error
+	if err == nil {
+		t.Errorf("unknown function should fail")
+	}
+}
+func TestMultiClusterSql(t *testing.T) {
+	// 在全部已注册的集群上查询，cluster 为对象所在的集群ID
+	var rows []map[string]interface{}
+	var report []kom.ClusterReport
+	err := kom.Sql("select cluster, metadata.namespace, metadata.name from pod where cluster in ('default') and status.phase='Running' order by cluster, metadata.name limit 10").
+		FillReport(&report).List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, row := range rows {
+		if row["cluster"] != "default" {
+			t.Errorf("row %v is not from cluster default", row)
+		}
+	}
+	for _, r := range report {
+		t.Logf("cluster %s skipped=%v count=%d duration=%v error=%v", r.Cluster, r.Skipped, r.Count, r.Duration, r.Error)
+	}
+
+	// 按集群分组统计
+	err = kom.MultiClusters("default").Sql("select cluster, status.phase, count(*) as total from pod group by cluster, status.phase order by total desc").List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, row := range rows {
+		t.Logf("cluster=%v phase=%v total=%v", row["cluster"], row["status.phase"], row["total"])
+	}
+
+	// 不存在的集群记录在执行情况中，不影响其他集群
+	var list []v1.Pod
+	err = kom.MultiClusters("default", "not-exists").Sql("select * from pod where metadata.namespace='kube-system'").FillReport(&report).List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, r := range report {
+		if r.Cluster == "not-exists" && r.Error == nil {
+			t.Errorf("cluster not-exists should report an error")
+		}
+	}
+}
+func TestListEachSql(t *testing.T) {
+	// 分页查询，逐个处理对象，不会一次性加载全部pod
+	count := 0
+	err := kom.DefaultCluster().Sql("select * from pod where status.phase='Running'").PageSize(50).
+		ListEach(func(obj *unstructured.Unstructured) error {
+			phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+			if phase != "Running" {
+				t.Errorf("pod %s/%s phase is %s", obj.GetNamespace(), obj.GetName(), phase)
+			}
+			count++
+			return nil
+		}).Error
+	if err != nil {
+		t.Fatalf("ListEach error %v", err)
+	}
+	t.Logf("running pods %d", count)
+
+	// 返回 ErrStopEach 提前结束遍历
+	visited := 0
+	err = kom.DefaultCluster().Resource(&v1.Pod{}).AllNamespace().ListEach(func(obj *unstructured.Unstructured) error {
+		visited++
+		if visited == 3 {
+			return kom.ErrStopEach
+		}
+		return nil
+	}).Error
+	if err != nil {
+		t.Fatalf("ListEach error %v", err)
+	}
+	if visited > 3 {
+		t.Errorf("ListEach visited %d objects after stop", visited)
+	}
+
+	// limit 及查询字段
+	var names []string
+	tx := kom.DefaultCluster().Sql("select metadata.name as name from pod limit 5").ListEach(func(obj *unstructured.Unstructured) error {
+		names = append(names, fmt.Sprintf("%v", obj.Object["name"]))
+		return nil
+	})
+	if tx.Error != nil {
+		t.Fatalf("ListEach error %v", tx.Error)
+	}
+	if len(names) > 5 || tx.Statement.RowsAffected != int64(len(names)) {
+		t.Errorf("ListEach limit 5 returned %d rows, RowsAffected %d", len(names), tx.Statement.RowsAffected)
+	}
+
+	// List 同样按页获取后过滤
+	var list []v1.Pod
+	err = kom.DefaultCluster().Sql("select * from pod where metadata.namespace='kube-system'").PageSize(10).List(&list).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	t.Logf("kube-system pods %d", len(list))
+}
@@ -0,0 +1,48 @@
+package example
+
+import (
+	"testing"
+
+	"github.com/weibaohui/kom/kom"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestTable(t *testing.T) {
+	var table kom.Table
+	err := kom.DefaultCluster().Resource(&corev1.Pod{}).Namespace("kube-system").Table(&table).Error
+	if err != nil {
+		t.Fatalf("Table error %v", err)
+	}
+	if len(table.Columns) == 0 || table.Columns[0].Name != "Name" {
+		t.Fatalf("first column should be Name, got %v", table.Columns)
+	}
+	for _, row := range table.Rows {
+		if len(row.Cells) != len(table.Columns) {
+			t.Errorf("row %s has %d cells, want %d", row.Name, len(row.Cells), len(table.Columns))
+		}
+		if row.Namespace != "kube-system" {
+			t.Errorf("pod %s/%s is not in kube-system", row.Namespace, row.Name)
+		}
+		t.Logf("%s %v", row.Namespace, row.Cells)
+	}
+
+	// sql 的where、order by、limit同样生效
+	err = kom.DefaultCluster().Sql("select * from deploy where metadata.namespace='kube-system' order by metadata.name limit 2").Table(&table).Error
+	if err != nil {
+		t.Fatalf("Table error %v", err)
+	}
+	if len(table.Rows) > 2 {
+		t.Errorf("Table returned %d rows, want at most 2", len(table.Rows))
+	}
+	for i, row := range table.Rows {
+		if len(row.Cells) != len(table.Columns) {
+			t.Errorf("row %s has %d cells, want %d", row.Name, len(row.Cells), len(table.Columns))
+		}
+		if i > 0 && table.Rows[i-1].Name > row.Name {
+			t.Errorf("rows are not ordered by name: %s > %s", table.Rows[i-1].Name, row.Name)
+		}
+	}
+	for _, c := range table.Columns {
+		t.Logf("column %s %s", c.Name, c.Type)
+	}
+}
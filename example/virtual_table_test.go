@@ -0,0 +1,53 @@
+package example
+
+import (
+	"testing"
+
+	"github.com/weibaohui/kom/kom"
+)
+
+func TestVirtualTableSql(t *testing.T) {
+	// 每个容器为一行，metadata 为所属pod的metadata
+	var rows []map[string]interface{}
+	err := kom.DefaultCluster().Sql("select metadata.namespace, metadata.name, name, image from container where metadata.namespace='kube-system' order by metadata.name, index").List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	for _, row := range rows {
+		if row["metadata.namespace"] != "kube-system" {
+			t.Errorf("container %v is not in kube-system", row)
+		}
+		if row["name"] == nil || row["image"] == nil {
+			t.Errorf("container row %v should have name and image", row)
+		}
+	}
+
+	// 没有设置内存limit的容器
+	err = kom.DefaultCluster().Sql("select metadata.name, name from container where resources.limits.memory is null").List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	t.Logf("containers without memory limits: %d", len(rows))
+
+	// Ready=False 超过10分钟的pod
+	err = kom.DefaultCluster().Sql("select metadata.namespace, metadata.name, lastTransitionTime from condition where type='Ready' and status='False' and lastTransitionTime < now() - '10m'").List(&rows).Error
+	if err != nil {
+		t.Fatalf("List error %v", err)
+	}
+	t.Logf("pods not ready for more than 10m: %d", len(rows))
+
+	// 虚拟表不支持修改
+	err = kom.DefaultCluster().Sql("delete from container where name='x'").Error
+	if err == nil {
+		t.Errorf("delete from virtual table should fail")
+	}
+
+	var plan kom.ExplainPlan
+	err = kom.DefaultCluster().Sql("select * from pod_volume where metadata.namespace='kube-system'").Explain(&plan).Error
+	if err != nil {
+		t.Fatalf("Explain error %v", err)
+	}
+	if plan.GVK.Kind != "Pod" || plan.Unnest != "spec.volumes" {
+		t.Errorf("pod_volume should unnest spec.volumes of Pod, got %s %s", plan.GVK.Kind, plan.Unnest)
+	}
+}
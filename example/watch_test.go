@@ -3,9 +3,11 @@ package example
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/weibaohui/kom/kom"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
@@ -40,3 +42,46 @@ func TestPodWatch(t *testing.T) {
 	}
 
 }
+
+func TestWatchWithWhere(t *testing.T) {
+	name := "kom-watch-where"
+	cm := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Data:       map[string]string{"phase": "Running"},
+	}
+	_ = kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).Delete().Error
+	if err := kom.DefaultCluster().Resource(&cm).Create(&cm).Error; err != nil {
+		t.Fatalf("Create error %v", err)
+	}
+	defer kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).Delete()
+
+	var watcher watch.Interface
+	err := kom.DefaultCluster().From("configmap").Namespace("default").
+		Where("metadata.name=? and data.phase='Failed'", name).Watch(&watcher).Error
+	if err != nil {
+		t.Fatalf("Watch error %v", err)
+	}
+	defer watcher.Stop()
+
+	// 不满足条件 -> 满足条件 -> 不满足条件
+	for _, phase := range []string{"Failed", "Running"} {
+		if err = kom.DefaultCluster().Resource(&cm).Namespace("default").Name(name).Get(&cm).Error; err != nil {
+			t.Fatalf("Get error %v", err)
+		}
+		cm.Data["phase"] = phase
+		if err = kom.DefaultCluster().Resource(&cm).Update(&cm).Error; err != nil {
+			t.Fatalf("Update error %v", err)
+		}
+	}
+
+	for _, want := range []watch.EventType{watch.Added, watch.Deleted} {
+		select {
+		case event := <-watcher.ResultChan():
+			if event.Type != want {
+				t.Errorf("event type %s, want %s", event.Type, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("wait %s event timeout", want)
+		}
+	}
+}
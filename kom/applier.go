@@ -1,21 +1,90 @@
 package kom
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/weibaohui/kom/utils"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/yaml"
 )
 
+// DefaultFieldManager 服务端应用时默认的field manager
+const DefaultFieldManager = "kom"
+
+// dryRunSuffix 试运行时执行结果的后缀
+const dryRunSuffix = " (server dry run)"
+
+// conflictManager 从冲突信息中提取field manager，如 conflict with "kubectl-client-side-apply" using apps/v1
+var conflictManager = regexp.MustCompile(`conflict with "([^"]*)"`)
+
 type applier struct {
-	kubectl *Kubectl
+	kubectl      *Kubectl
+	serverSide   bool   // 使用服务端应用
+	fieldManager string // 服务端应用的field manager
+	force        bool   // 强制接管冲突的字段
+}
+
+// ApplyConflict 服务端应用时与其他field manager管理的字段冲突
+type ApplyConflict struct {
+	Manager string `json:"manager,omitempty"` // 当前管理该字段的field manager
+	Field   string `json:"field,omitempty"`   // 冲突的字段，如 .spec.replicas
+	Message string `json:"message,omitempty"` // api server返回的冲突信息
+}
+
+// ApplyResult 服务端应用单个资源的结果
+type ApplyResult struct {
+	Kind      string          `json:"kind,omitempty"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Conflicts []ApplyConflict `json:"conflicts,omitempty"` // 与其他field manager冲突的字段，未强制接管时不会修改资源
+	DryRun    bool            `json:"dryRun,omitempty"`    // 是否为试运行
+	Error     error           `json:"-"`
+}
+
+// String 与 Apply 返回的执行结果格式一致
+func (r ApplyResult) String() string {
+	if r.Error != nil {
+		if r.Kind == "" {
+			return r.Error.Error()
+		}
+		return fmt.Sprintf("apply %s %s/%s error:%v", r.Kind, r.Namespace, r.Name, r.Error)
+	}
+	if r.DryRun {
+		return fmt.Sprintf("%s/%s serverside-applied%s", r.Kind, r.Name, dryRunSuffix)
+	}
+	return fmt.Sprintf("%s/%s serverside-applied", r.Kind, r.Name)
+}
+
+// ServerSide 使用服务端应用（Server-Side Apply）代替先Get再Update或Create，只修改YAML中包含的字段
+// fieldManager 为空时使用 DefaultFieldManager。force 为false时，与其他field manager（如GitOps控制器）冲突的资源不会被修改，
+// 冲突的字段在结果中返回，为true时强制接管冲突的字段
+//
+//	results := kom.DefaultCluster().Applier().ServerSide("my-tool", false).Apply(yaml)
+//	for _, r := range kom.DefaultCluster().Applier().ServerSide("my-tool", false).ApplyResults(yaml) {
+//		fmt.Println(r.String(), r.Conflicts)
+//	}
+func (a *applier) ServerSide(fieldManager string, force bool) *applier {
+	if fieldManager == "" {
+		fieldManager = DefaultFieldManager
+	}
+	return &applier{kubectl: a.kubectl, serverSide: true, fieldManager: fieldManager, force: force}
 }
 
 func (a *applier) Apply(str string) (result []string) {
+	if a.serverSide {
+		for _, r := range a.ApplyResults(str) {
+			result = append(result, r.String())
+		}
+		return result
+	}
 	docs := splitYAML(str)
 
 	for _, doc := range docs {
@@ -33,6 +102,95 @@ func (a *applier) Apply(str string) (result []string) {
 
 	return result
 }
+
+// ApplyResults 使用服务端应用创建或更新YAML中的资源，返回每一条资源的结构化结果，未调用 ServerSide 时使用 DefaultFieldManager
+func (a *applier) ApplyResults(str string) (results []ApplyResult) {
+	fieldManager := a.fieldManager
+	if fieldManager == "" {
+		fieldManager = DefaultFieldManager
+	}
+	for _, doc := range splitYAML(str) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		var obj unstructured.Unstructured
+		if err := yaml.Unmarshal([]byte(doc), &obj.Object); err != nil {
+			results = append(results, ApplyResult{Error: fmt.Errorf("YAML 解析失败: %v", err)})
+			continue
+		}
+		results = append(results, a.serverSideApply(&obj, fieldManager))
+	}
+	return results
+}
+
+// serverSideApply 使用服务端应用创建或更新单个资源
+func (a *applier) serverSideApply(obj *unstructured.Unstructured, fieldManager string) ApplyResult {
+	gvk := obj.GroupVersionKind()
+	result := ApplyResult{Kind: gvk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName(), DryRun: a.kubectl.Statement.DryRun}
+	if gvk.Kind == "" || gvk.Version == "" {
+		result.Error = fmt.Errorf("YAML 缺少必要的 Group, Version 或 Kind")
+		return result
+	}
+
+	_, namespaced := a.kubectl.Tools().ParseGVK2GVR([]schema.GroupVersionKind{gvk})
+	if result.Namespace == "" && namespaced {
+		result.Namespace = metav1.NamespaceDefault // 默认命名空间
+		obj.SetNamespace(result.Namespace)
+	}
+	err := a.kubectl.CRD(gvk.Group, gvk.Version, gvk.Kind).Namespace(result.Namespace).Name(result.Name).
+		ServerSideApply(obj, fieldManager, a.force).Error
+	if err != nil {
+		result.Error = err
+		result.Conflicts = ApplyConflicts(err)
+	}
+	return result
+}
+
+// ApplyConflicts 获取服务端应用冲突错误中的冲突字段，不是冲突错误时返回nil
+func ApplyConflicts(err error) []ApplyConflict {
+	var status apierrors.APIStatus
+	if err == nil || !errors.As(err, &status) {
+		return nil
+	}
+	details := status.Status().Details
+	if status.Status().Reason != metav1.StatusReasonConflict || details == nil {
+		return nil
+	}
+	var conflicts []ApplyConflict
+	for _, cause := range details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		conflict := ApplyConflict{Field: cause.Field, Message: cause.Message}
+		if m := conflictManager.FindStringSubmatch(cause.Message); m != nil {
+			conflict.Manager = m[1]
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts
+}
+
+// applyPatchData 将对象转换为服务端应用的请求内容，补齐apiVersion、kind，去掉managedFields及creationTimestamp
+func applyPatchData(obj interface{}, gvk schema.GroupVersionKind) (string, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return "", err
+	}
+	apply := &unstructured.Unstructured{Object: content}
+	if apply.GetAPIVersion() == "" {
+		apply.SetAPIVersion(gvk.GroupVersion().String())
+	}
+	if apply.GetKind() == "" {
+		apply.SetKind(gvk.Kind)
+	}
+	unstructured.RemoveNestedField(apply.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(apply.Object, "metadata", "creationTimestamp")
+	data, err := json.Marshal(apply.Object)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
 func (a *applier) Delete(str string) (result []string) {
 	docs := splitYAML(str)
 
@@ -78,14 +236,14 @@ func (a *applier) createOrUpdateCRD(obj *unstructured.Unstructured) string {
 		if err != nil {
 			return fmt.Sprintf("update %s/%s,%s %s/%s error:%v", gvk.Group, gvk.Version, gvk.Kind, ns, name, err)
 		}
-		return fmt.Sprintf("%s/%s updated", kind, name)
+		return fmt.Sprintf("%s/%s updated%s", kind, name, a.dryRunSuffix())
 	} else {
 		// 不存在，那么就创建
 		err = a.kubectl.CRD(gvk.Group, gvk.Version, gvk.Kind).Name(name).Namespace(ns).Create(&obj).Error
 		if err != nil {
 			return fmt.Sprintf("create %s/%s,%s %s/%s error:%v", gvk.Group, gvk.Version, gvk.Kind, ns, name, err)
 		}
-		return fmt.Sprintf("%s/%s created", kind, name)
+		return fmt.Sprintf("%s/%s created%s", kind, name, a.dryRunSuffix())
 	}
 }
 func (a *applier) deleteCRD(obj *unstructured.Unstructured) string {
@@ -100,7 +258,15 @@ func (a *applier) deleteCRD(obj *unstructured.Unstructured) string {
 	if err != nil {
 		return fmt.Sprintf("delete %s/%s,%s %s/%s error:%v", gvk.Group, gvk.Version, gvk.Kind, ns, name, err)
 	}
-	return fmt.Sprintf("%s/%s deleted", gvk.Kind, name)
+	return fmt.Sprintf("%s/%s deleted%s", gvk.Kind, name, a.dryRunSuffix())
+}
+
+// dryRunSuffix 试运行时在执行结果后追加的标识，与kubectl一致
+func (a *applier) dryRunSuffix() string {
+	if a.kubectl.Statement.DryRun {
+		return dryRunSuffix
+	}
+	return ""
 }
 
 // splitYAML 按 "---" 分割多文档 YAML
@@ -0,0 +1,139 @@
+package kom
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+)
+
+// cacheIndex 记录Get、List缓存key对应的资源及命名空间
+// 创建、更新、Patch、删除后按资源及命名空间清除相关的缓存，避免写操作后仍读到旧数据
+type cacheIndex struct {
+	lock sync.Mutex
+	keys map[schema.GroupResource]map[string]cacheEntry
+}
+
+// cacheEntry 缓存key涉及的命名空间及过期时间
+type cacheEntry struct {
+	namespaces []string // 查询涉及的命名空间，为空表示全部命名空间或集群级资源
+	expire     time.Time
+}
+
+func newCacheIndex() *cacheIndex {
+	return &cacheIndex{keys: make(map[schema.GroupResource]map[string]cacheEntry)}
+}
+
+// clear 清空索引
+func (c *cacheIndex) clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.keys = make(map[schema.GroupResource]map[string]cacheEntry)
+}
+
+// GetCacheKey Get查询的缓存key
+func (s *Statement) GetCacheKey() string {
+	return fmt.Sprintf("get/%s/%s/%s/%s/%s", s.GVR.Group, s.GVR.Version, s.GVR.Resource, s.cacheNamespace(), s.Name)
+}
+
+// cacheNamespace Get及写操作所在的命名空间，命名空间资源未指定时为default
+func (s *Statement) cacheNamespace() string {
+	if !s.Namespaced {
+		return ""
+	}
+	if s.Namespace == "" {
+		return metav1.NamespaceDefault
+	}
+	return s.Namespace
+}
+
+// TrackCache 记录当前资源的缓存key，未设置缓存时间时不记录
+// namespaces 为查询涉及的命名空间，为空或包含空字符串表示全部命名空间
+func (s *Statement) TrackCache(key string, namespaces ...string) {
+	index := s.cacheIndex()
+	if index == nil || s.CacheTTL <= 0 {
+		return
+	}
+	for _, ns := range namespaces {
+		if ns == metav1.NamespaceAll {
+			namespaces = nil
+			break
+		}
+	}
+	gr := s.GVR.GroupResource()
+	now := time.Now()
+
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	entries := index.keys[gr]
+	if entries == nil {
+		entries = make(map[string]cacheEntry)
+		index.keys[gr] = entries
+	}
+	// 顺便清理已过期的key
+	for k, e := range entries {
+		if now.After(e.expire) {
+			delete(entries, k)
+		}
+	}
+	entries[key] = cacheEntry{namespaces: namespaces, expire: now.Add(s.CacheTTL)}
+}
+
+// InvalidateCache 清除当前资源在指定命名空间中的Get、List缓存，不传namespaces时清除该资源的全部缓存
+// 查询全部命名空间的列表缓存包含任意命名空间的对象，总会被清除
+func (s *Statement) InvalidateCache(namespaces ...string) {
+	index := s.cacheIndex()
+	if index == nil {
+		return
+	}
+	cache := s.ClusterCache()
+	gr := s.GVR.GroupResource()
+
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	for key, entry := range index.keys[gr] {
+		if len(namespaces) > 0 && len(entry.namespaces) > 0 && !containsAny(entry.namespaces, namespaces) {
+			continue
+		}
+		klog.V(6).Infof("invalidate cache key %s", key)
+		cache.Del(key)
+		delete(index.keys[gr], key)
+	}
+}
+
+// cacheIndex 获取集群的缓存索引
+func (s *Statement) cacheIndex() *cacheIndex {
+	cluster := s.parentCluster()
+	if cluster == nil {
+		return nil
+	}
+	return cluster.cacheIndex
+}
+
+// InvalidateCache 清除指定资源的Get、List缓存，不传namespaces时清除该资源在全部命名空间中的缓存
+// 通过kom执行的创建、更新、Patch、删除会自动清除相关缓存，资源被其他程序修改时可调用此方法
+//
+//	kom.DefaultCluster().Tools().InvalidateCache(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, "default")
+func (u *tools) InvalidateCache(gvk schema.GroupVersionKind, namespaces ...string) {
+	tx := u.kubectl.GVK(gvk.Group, gvk.Version, gvk.Kind)
+	if tx.Statement.GVR.Resource == "" {
+		klog.V(6).Infof("invalidate cache: resource of %s not found", gvk.String())
+		return
+	}
+	tx.Statement.InvalidateCache(namespaces...)
+}
+
+// containsAny a 中是否包含 b 中的任意一个元素
+func containsAny(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -41,6 +41,7 @@ func (k *Kubectl) initializeCallbacks() *callbacks {
 			"watch":       {km: k},
 			"describe":    {km: k},
 			"stream-exec": {km: k},
+			"table":       {km: k},
 		},
 	}
 }
@@ -79,6 +80,9 @@ func (cs *callbacks) Logs() *processor {
 func (cs *callbacks) Watch() *processor {
 	return cs.processors["watch"]
 }
+func (cs *callbacks) Table() *processor {
+	return cs.processors["table"]
+}
 func (c *callback) Remove(name string) error {
 	klog.V(4).Infof("removing callback `%s` \n", name)
 	c.name = name
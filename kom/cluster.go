@@ -42,6 +42,8 @@ type ClusterInst struct {
 	describerMap  map[schema.GroupKind]describe.ResourceDescriber
 	Cache         *ristretto.Cache[string, any]
 	openAPISchema *openapi_v2.Document // openapi
+	informer      *informerCache       // informer缓存，默认不启用
+	cacheIndex    *cacheIndex          // Get、List缓存key索引，写操作后清除相关缓存
 }
 
 // Clusters 集群实例管理器
@@ -177,6 +179,8 @@ func (c *ClusterInstances) RegisterByConfigWithID(config *rest.Config, id string
 		}
 		cluster.Client = client               // kubernetes 客户端
 		cluster.DynamicClient = dynamicClient // 动态客户端
+		cluster.informer = newInformerCache(dynamicClient)
+		cluster.cacheIndex = newCacheIndex()
 		// 缓存
 		cluster.apiResources = k.initializeAPIResources()       // API 资源
 		cluster.crdList = k.initializeCRDList(time.Minute * 10) // CRD列表,10分钟缓存
@@ -210,6 +214,10 @@ func (c *ClusterInstances) GetClusterById(id string) *ClusterInst {
 
 // RemoveClusterById 删除集群
 func (c *ClusterInstances) RemoveClusterById(id string) {
+	if cluster, exists := c.clusters[id]; exists && cluster.informer != nil {
+		// 停止集群的informer
+		cluster.informer.Disable()
+	}
 	delete(c.clusters, id)
 }
 
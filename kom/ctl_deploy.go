@@ -112,20 +112,20 @@ func (d *deploy) ManagedLatestReplicaSet() (*v1.ReplicaSet, error) {
 
 func (d *deploy) ReplaceImageTag(targetContainerName string, tag string) (*v1.Deployment, error) {
 	var item v1.Deployment
-	err := d.kubectl.Resource(&item).Get(&item).Error
-
+	err := d.kubectl.Resource(&item).Mutate(&item, func(obj interface{}) error {
+		deploy := obj.(*v1.Deployment)
+		for i := range deploy.Spec.Template.Spec.Containers {
+			c := &deploy.Spec.Template.Spec.Containers[i]
+			if c.Name == targetContainerName {
+				c.Image = replaceImageTag(c.Image, tag)
+			}
+		}
+		return nil
+	}).Error
 	if err != nil {
 		return nil, err
 	}
-
-	for i := range item.Spec.Template.Spec.Containers {
-		c := &item.Spec.Template.Spec.Containers[i]
-		if c.Name == targetContainerName {
-			c.Image = replaceImageTag(c.Image, tag)
-		}
-	}
-	err = d.kubectl.Resource(&item).Update(&item).Error
-	return &item, err
+	return &item, nil
 }
 
 // replaceImageTag 替换镜像的 tag
@@ -471,8 +471,11 @@ func (d *rollout) rollbackDeployment(toVersion int) error {
 	}
 	spec := vrs.Spec.Template.Spec
 
-	deploy.Spec.Template.Spec = spec
-	err = d.kubectl.Resource(&deploy).Update(&deploy).Error
+	// 更新冲突时重新读取并重试
+	err = d.kubectl.Resource(&deploy).Mutate(&deploy, func(obj interface{}) error {
+		obj.(*v1.Deployment).Spec.Template.Spec = spec
+		return nil
+	}).Error
 	if err != nil {
 		return fmt.Errorf(" rollbackDeployment rollout undo deployment  err %v ", err)
 	}
@@ -582,11 +585,11 @@ func (d *rollout) rollbackDaemonSet(toVersion int) error {
 		return fmt.Errorf("rollbackDaemonSet unmarshal controllerrevision data err %v", err)
 	}
 
-	// 使用目标版本的模板更新当前 DaemonSet
-	ds.Spec.Template.Spec = dsTemplate.Spec.Template.Spec
-
-	// 更新 DaemonSet
-	err = d.kubectl.Resource(&ds).Update(&ds).Error
+	// 使用目标版本的模板更新当前 DaemonSet，更新冲突时重新读取并重试
+	err = d.kubectl.Resource(&ds).Mutate(&ds, func(obj interface{}) error {
+		obj.(*v1.DaemonSet).Spec.Template.Spec = dsTemplate.Spec.Template.Spec
+		return nil
+	}).Error
 	if err != nil {
 		return fmt.Errorf("rollbackDaemonSet update daemonset err %v", err)
 	}
@@ -671,11 +674,11 @@ func (d *rollout) rollbackStatefulSet(toVersion int) error {
 		return fmt.Errorf("rollbackStatefulSet unmarshal controllerrevision data err %v", err)
 	}
 
-	// 使用目标版本的模板更新当前 DaemonSet
-	sts.Spec.Template.Spec = stsTemplate.Spec.Template.Spec
-
-	// 更新 DaemonSet
-	err = d.kubectl.Resource(&sts).Update(&sts).Error
+	// 使用目标版本的模板更新当前 StatefulSet，更新冲突时重新读取并重试
+	err = d.kubectl.Resource(&sts).Mutate(&sts, func(obj interface{}) error {
+		obj.(*v1.StatefulSet).Spec.Template.Spec = stsTemplate.Spec.Template.Spec
+		return nil
+	}).Error
 	if err != nil {
 		return fmt.Errorf("rollbackStatefulSet update daemonset err %v", err)
 	}
@@ -0,0 +1,303 @@
+package kom
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// InformerSyncTimeout 首次从informer读取时等待同步完成的最长时间，超时后本次查询直接请求api server
+var InformerSyncTimeout = 30 * time.Second
+
+// labelIndex informer中按label建立的索引，索引值为 key=value
+const labelIndex = "labels"
+
+// informerCache 集群的informer缓存
+// 启用后 Get、List、Sql 从informer的索引中读取对象，不再请求api server，对象变化通过watch实时更新
+// 默认不启用，可以对整个集群启用，也可以只对部分资源启用
+type informerCache struct {
+	client  dynamic.Interface
+	lock    sync.Mutex
+	enabled bool
+	all     bool                                 // 对全部资源启用，首次查询时启动对应资源的informer
+	gvrs    map[schema.GroupVersionResource]bool // 启用informer的资源
+	waited  map[schema.GroupVersionResource]bool // 已等待过同步的资源，同步失败时后续查询不再等待
+	created map[schema.GroupVersionResource]bool // 已创建的informer
+	factory dynamicinformer.DynamicSharedInformerFactory
+	stopCh  chan struct{}
+}
+
+func newInformerCache(client dynamic.Interface) *informerCache {
+	return &informerCache{client: client}
+}
+
+// InformerCache 获取集群的informer缓存
+//
+//	// 对整个集群启用，首次查询某种资源时启动该资源的informer
+//	kom.DefaultCluster().InformerCache().Enable()
+//	// 只对pod、deployment启用，立即启动informer
+//	kom.DefaultCluster().InformerCache().Enable(
+//		schema.GroupVersionResource{Version: "v1", Resource: "pods"},
+//		schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+//	)
+func (k *Kubectl) InformerCache() *informerCache {
+	return k.parentCluster().informer
+}
+
+// Enable 启用informer缓存，不传gvrs时对全部资源启用，可多次调用追加资源
+// 指定的资源立即启动informer，对全部资源启用时在首次查询时启动
+func (c *informerCache) Enable(gvrs ...schema.GroupVersionResource) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.enabled {
+		c.enabled = true
+		c.factory = dynamicinformer.NewDynamicSharedInformerFactory(c.client, 0)
+		c.stopCh = make(chan struct{})
+		c.gvrs = make(map[schema.GroupVersionResource]bool)
+		c.waited = make(map[schema.GroupVersionResource]bool)
+		c.created = make(map[schema.GroupVersionResource]bool)
+	}
+	if len(gvrs) == 0 {
+		c.all = true
+		return
+	}
+	for _, gvr := range gvrs {
+		c.gvrs[gvr] = true
+		c.informerFor(gvr)
+	}
+	c.factory.Start(c.stopCh)
+}
+
+// Disable 停止全部informer，之后的查询直接请求api server
+func (c *informerCache) Disable() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.enabled {
+		return
+	}
+	close(c.stopCh)
+	c.factory.Shutdown()
+	c.enabled = false
+	c.all = false
+	c.gvrs, c.waited, c.created = nil, nil, nil
+	c.factory, c.stopCh = nil, nil
+}
+
+// Enabled 资源是否启用了informer缓存
+func (c *informerCache) Enabled(gvr schema.GroupVersionResource) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.enabled && (c.all || c.gvrs[gvr])
+}
+
+// HasSynced 资源的informer是否已完成同步
+func (c *informerCache) HasSynced(gvr schema.GroupVersionResource) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.enabled || !c.created[gvr] {
+		return false
+	}
+	return c.factory.ForResource(gvr).Informer().HasSynced()
+}
+
+// informerFor 获取资源的informer，首次获取时添加label索引，需在持有锁时调用
+func (c *informerCache) informerFor(gvr schema.GroupVersionResource) cache.SharedIndexInformer {
+	informer := c.factory.ForResource(gvr).Informer()
+	if !c.created[gvr] {
+		c.created[gvr] = true
+		if err := informer.AddIndexers(cache.Indexers{labelIndex: labelIndexFunc}); err != nil {
+			klog.V(6).Infof("informer %s add label index error: %v", gvr.String(), err)
+		}
+	}
+	return informer
+}
+
+// indexer 获取已同步的informer索引，未启用或未完成同步时返回false
+// 首次查询时启动informer并等待同步，等待超时后本次及后续查询在同步完成前均直接请求api server
+func (c *informerCache) indexer(ctx context.Context, gvr schema.GroupVersionResource) (cache.Indexer, bool) {
+	c.lock.Lock()
+	if !c.enabled || (!c.all && !c.gvrs[gvr]) {
+		c.lock.Unlock()
+		return nil, false
+	}
+	informer := c.informerFor(gvr)
+	c.factory.Start(c.stopCh)
+	wait := !c.waited[gvr]
+	c.waited[gvr] = true
+	c.lock.Unlock()
+
+	if !informer.HasSynced() {
+		if !wait {
+			return nil, false
+		}
+		ctx, cancel := context.WithTimeout(ctx, InformerSyncTimeout)
+		defer cancel()
+		if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			klog.V(2).Infof("informer %s not synced in %v, list from api server", gvr.String(), InformerSyncTimeout)
+			return nil, false
+		}
+	}
+	return informer.GetIndexer(), true
+}
+
+// labelIndexFunc 按label建立索引，每个label的索引值为 key=value
+func labelIndexFunc(obj interface{}) ([]string, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(accessor.GetLabels()))
+	for k, v := range accessor.GetLabels() {
+		keys = append(keys, k+"="+v)
+	}
+	return keys, nil
+}
+
+// InformerEnabled 当前资源是否启用了informer缓存
+func (s *Statement) InformerEnabled() bool {
+	cluster := s.parentCluster()
+	return cluster != nil && cluster.informer != nil && cluster.informer.Enabled(s.GVR)
+}
+
+// InformerList 从informer缓存中查询对象，返回的对象与缓存共享，不能修改
+// namespaces 为空或包含空字符串时查询全部命名空间，label selector 优先使用label索引，其次使用命名空间索引
+// 未启用informer、未完成同步，或ListOptions指定了Limit、Continue、ResourceVersion时返回false，需请求api server
+func (s *Statement) InformerList(namespaces []string, opt metav1.ListOptions) ([]unstructured.Unstructured, bool, error) {
+	if opt.Limit > 0 || opt.Continue != "" || opt.ResourceVersion != "" || !s.InformerEnabled() {
+		return nil, false, nil
+	}
+	indexer, ok := s.parentCluster().informer.indexer(s.Context, s.GVR)
+	if !ok {
+		return nil, false, nil
+	}
+	labelSelector, err := labels.Parse(opt.LabelSelector)
+	if err != nil {
+		return nil, true, err
+	}
+	fieldSelector, err := fields.ParseSelector(opt.FieldSelector)
+	if err != nil {
+		return nil, true, err
+	}
+
+	allNamespaces := !s.Namespaced || len(namespaces) == 0
+	nsSet := sets.New[string]()
+	for _, ns := range namespaces {
+		if ns == metav1.NamespaceAll {
+			allNamespaces = true
+		}
+		nsSet.Insert(ns)
+	}
+
+	var objs []interface{}
+	if keys := labelIndexKeys(labelSelector); len(keys) > 0 {
+		for _, key := range keys {
+			items, err := indexer.ByIndex(labelIndex, key)
+			if err != nil {
+				return nil, true, err
+			}
+			objs = append(objs, items...)
+		}
+	} else if allNamespaces {
+		objs = indexer.List()
+	} else {
+		for _, ns := range sets.List(nsSet) {
+			items, err := indexer.ByIndex(cache.NamespaceIndex, ns)
+			if err != nil {
+				return nil, true, err
+			}
+			objs = append(objs, items...)
+		}
+	}
+
+	result := make([]unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		item, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		if !allNamespaces && !nsSet.Has(item.GetNamespace()) {
+			continue
+		}
+		if !labelSelector.Matches(labels.Set(item.GetLabels())) {
+			continue
+		}
+		if !fieldSelector.Empty() && !fieldSelector.Matches(objectFields(item, fieldSelector)) {
+			continue
+		}
+		result = append(result, *item)
+	}
+	return result, true, nil
+}
+
+// InformerGet 从informer缓存中获取对象，返回的对象与缓存共享，不能修改
+// 命名空间资源的namespace为空时使用default命名空间，未启用informer或未完成同步时返回false，需请求api server
+func (s *Statement) InformerGet(namespace, name string) (*unstructured.Unstructured, bool, error) {
+	if !s.InformerEnabled() {
+		return nil, false, nil
+	}
+	indexer, ok := s.parentCluster().informer.indexer(s.Context, s.GVR)
+	if !ok {
+		return nil, false, nil
+	}
+	key := name
+	if s.Namespaced {
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+		key = namespace + "/" + name
+	}
+	obj, exists, err := indexer.GetByKey(key)
+	if err != nil {
+		return nil, true, err
+	}
+	if !exists {
+		return nil, true, apierrors.NewNotFound(s.GVR.GroupResource(), name)
+	}
+	item, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, true, fmt.Errorf("informer object %s is %T", key, obj)
+	}
+	return item, true, nil
+}
+
+// labelIndexKeys 从label selector中取一个 =、in 条件，转换为label索引值
+func labelIndexKeys(selector labels.Selector) []string {
+	requirements, _ := selector.Requirements()
+	for _, r := range requirements {
+		switch r.Operator() {
+		case selection.Equals, selection.DoubleEquals, selection.In:
+			var keys []string
+			for _, v := range r.Values().List() {
+				keys = append(keys, r.Key()+"="+v)
+			}
+			return keys
+		}
+	}
+	return nil
+}
+
+// objectFields 取出field selector中字段在对象上的值，用于本地匹配field selector
+func objectFields(item *unstructured.Unstructured, selector fields.Selector) fields.Set {
+	set := fields.Set{}
+	for _, r := range selector.Requirements() {
+		value, _, _ := unstructured.NestedString(item.Object, strings.Split(r.Field, ".")...)
+		set[r.Field] = value
+	}
+	return set
+}
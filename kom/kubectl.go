@@ -62,6 +62,7 @@ func (k *Kubectl) getInstance() *Kubectl {
 			CacheTTL:     k.Statement.CacheTTL,
 			Filter:       k.Statement.Filter,
 			ForceDelete:  k.Statement.ForceDelete,
+			DryRun:       k.Statement.DryRun,
 		}
 		return tx
 	}
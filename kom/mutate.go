@@ -0,0 +1,53 @@
+package kom
+
+import (
+	"fmt"
+	"reflect"
+
+	"k8s.io/client-go/util/retry"
+)
+
+// MutateFunc Mutate 的修改函数，obj 为传入 Mutate 的dest，已填充为最新的对象
+type MutateFunc func(obj interface{}) error
+
+// Mutate 读取最新的对象，调用fn修改后执行Update，更新冲突（409）时按 retry.DefaultRetry 退避，重新读取并重试
+// 读取不使用缓存及informer，fn 可能被调用多次，应基于传入的对象修改，返回错误时不再更新。dest 支持结构体及unstructured对象
+//
+//	var deploy v1.Deployment
+//	err := kom.DefaultCluster().Resource(&deploy).Namespace("default").Name("nginx").
+//		Mutate(&deploy, func(obj interface{}) error {
+//			obj.(*v1.Deployment).Spec.Replicas = utils.Int32Ptr(3)
+//			return nil
+//		}).Error
+func (k *Kubectl) Mutate(dest interface{}, fn MutateFunc) *Kubectl {
+	tx := k.getInstance()
+	if tx.Error != nil {
+		return tx
+	}
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		tx.Error = fmt.Errorf("Mutate 请传入指针类型的dest")
+		return tx
+	}
+	tx.Error = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		// 每次使用新的Statement，避免上一次的结果影响重试
+		s := *tx.Statement
+		s.CacheTTL = 0
+		s.ReadLatest = true
+		attempt := &Kubectl{ID: tx.ID, Statement: &s}
+
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+		if err := attempt.Get(dest).Error; err != nil {
+			return err
+		}
+		if err := fn(dest); err != nil {
+			return err
+		}
+		if err := attempt.Update(dest).Error; err != nil {
+			return err
+		}
+		tx.Statement.RowsAffected = s.RowsAffected
+		return nil
+	})
+	return tx
+}
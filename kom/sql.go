@@ -2,9 +2,9 @@ package kom
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"strings"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
@@ -59,14 +59,8 @@ func (k *Kubectl) Namespace(namespaces ...string) *Kubectl {
 		tx.Statement.NamespaceList = append(tx.Statement.NamespaceList, ns)
 	}
 
-	var parts []string
-	for _, ns := range tx.Statement.NamespaceList {
-		parts = append(parts, fmt.Sprintf("metadata.namespace='%s'", ns))
-	}
-	result := strings.Join(parts, " or ")
-	result = fmt.Sprintf("(%s)", result)
-	if result != "()" {
-		k.Where(result)
+	if len(tx.Statement.NamespaceList) > 0 {
+		tx.Where("metadata.namespace in ?", tx.Statement.NamespaceList)
 	}
 	return tx
 }
@@ -99,6 +93,17 @@ func (k *Kubectl) WithCache(ttl time.Duration) *Kubectl {
 	return tx
 }
 
+// DryRun 服务端试运行，之后的Create、Update、Patch、ServerSideApply、Delete及Applier只经过准入Webhook及校验，不会持久化
+// 执行后对象为api server将要保存的对象，删除只校验能否删除
+//
+//	err := kom.DefaultCluster().Resource(&deploy).DryRun().Update(&deploy).Error
+//	results := kom.DefaultCluster().DryRun().Applier().Apply(yaml)
+func (k *Kubectl) DryRun() *Kubectl {
+	tx := k.getInstance()
+	tx.Statement.DryRun = true
+	return tx
+}
+
 func (k *Kubectl) CRD(group string, version string, kind string) *Kubectl {
 	return k.GVK(group, version, kind)
 }
@@ -156,30 +161,73 @@ func (k *Kubectl) Describe(dest interface{}) *Kubectl {
 }
 func (k *Kubectl) List(dest interface{}, opt ...metav1.ListOptions) *Kubectl {
 	tx := k.getInstance()
+	tx.mergeListOptions(opt)
+
+	tx.Statement.Dest = dest
+	if tx.Statement.Filter.Explain {
+		// explain 语句返回执行计划，不查询资源
+		if tx.Error == nil {
+			tx.Error = tx.Statement.fillExplain(dest)
+		}
+		return tx
+	}
+	tx.Error = tx.Callback().List().Execute(tx)
+	return tx
+}
+
+// ErrStopEach ListEach 的回调函数返回该错误时停止遍历，ListEach 不会返回该错误
+var ErrStopEach = errors.New("stop each")
+
+// ListEach 分页查询资源，逐个回调满足where条件的对象，不会一次性加载全部对象
+// 按api server返回的顺序回调，不使用缓存，不支持order by、group by、聚合函数及关联查询，支持limit、offset
+// 指定查询字段时，回调的对象为查询字段组成的行。回调函数返回错误时停止遍历，返回 ErrStopEach 时正常结束
+// RowsAffected 为回调的对象数量
+//
+//	err := kom.DefaultCluster().Sql("select * from pod where status.phase='Running'").ListEach(func(obj *unstructured.Unstructured) error {
+//		fmt.Println(obj.GetNamespace(), obj.GetName())
+//		return nil
+//	}).Error
+func (k *Kubectl) ListEach(fn ListEachFunc, opt ...metav1.ListOptions) *Kubectl {
+	tx := k.getInstance()
+	tx.mergeListOptions(opt)
 
+	if tx.Statement.Filter.Explain {
+		tx.Error = fmt.Errorf("explain 语句请使用 List 或 Explain 获取执行计划")
+		return tx
+	}
+	tx.Statement.Each = fn
+	tx.Error = tx.Callback().List().Execute(tx)
+	return tx
+}
+
+// PageSize 设置列表查询每页获取的对象数量，使用 Limit、Continue 分页获取，默认为 DefaultPageSize
+func (k *Kubectl) PageSize(size int64) *Kubectl {
+	tx := k.getInstance()
+	tx.Statement.PageSize = size
+	return tx
+}
+
+// mergeListOptions 合并List传入的ListOptions
+func (k *Kubectl) mergeListOptions(opt []metav1.ListOptions) {
 	// 先判断opt是否有值，没有值，不用处理了。
 	// 如果opt没有值，那么前面步骤使用WithLabelSelector，那就沿用，没用就为空。
 	// 如果opt有值，使用 opt进行合并
 	if opt != nil && len(opt) >= 0 {
 		// 之前步骤可能使用WithLabelSelector 设置了option
-		if len(tx.Statement.ListOptions) == 0 {
+		if len(k.Statement.ListOptions) == 0 {
 			// 之前也没有设置值，那么直接使用opt
-			tx.Statement.ListOptions = opt
+			k.Statement.ListOptions = opt
 		} else {
 			// 之前有值，需要合并值
 			// 之前的值只可能是在selector，所以应该以现在的opt为基准，合并之前opt的selector
-			preOpt := tx.Statement.ListOptions[0]
+			preOpt := k.Statement.ListOptions[0]
 			currentOpt := opt[0]
 			currentOpt.LabelSelector = mergeSelectors(preOpt.LabelSelector, currentOpt.LabelSelector)
 			currentOpt.FieldSelector = mergeSelectors(preOpt.FieldSelector, currentOpt.FieldSelector)
 
-			tx.Statement.ListOptions = []metav1.ListOptions{currentOpt}
+			k.Statement.ListOptions = []metav1.ListOptions{currentOpt}
 		}
 	}
-
-	tx.Statement.Dest = dest
-	tx.Error = tx.Callback().List().Execute(tx)
-	return tx
 }
 
 // 合并两个选择器，使用逗号分隔
@@ -231,6 +279,33 @@ func (k *Kubectl) Patch(dest interface{}, pt types.PatchType, data string) *Kube
 	return tx
 }
 
+// ServerSideApply 使用服务端应用（Server-Side Apply）创建或更新资源，obj 中只需包含 fieldManager 要管理的字段
+// fieldManager 为空时使用 DefaultFieldManager。force 为true时强制接管与其他field manager冲突的字段，
+// 为false时冲突返回错误，可通过 ApplyConflicts 获取冲突的字段及其管理者。执行后obj为服务端返回的完整对象
+//
+//	err := kom.DefaultCluster().Resource(&deploy).ServerSideApply(&deploy, "my-controller", false).Error
+//	for _, c := range kom.ApplyConflicts(err) {
+//		fmt.Printf("%s is managed by %s\n", c.Field, c.Manager)
+//	}
+func (k *Kubectl) ServerSideApply(obj interface{}, fieldManager string, force bool) *Kubectl {
+	tx := k.getInstance()
+	if fieldManager == "" {
+		fieldManager = DefaultFieldManager
+	}
+	data, err := applyPatchData(obj, tx.Statement.GVK)
+	if err != nil {
+		tx.Error = err
+		return tx
+	}
+	tx.Statement.Dest = obj
+	tx.Statement.PatchData = data
+	tx.Statement.PatchType = types.ApplyPatchType
+	tx.Statement.FieldManager = fieldManager
+	tx.Statement.ForceApply = force
+	tx.Error = tx.Callback().Patch().Execute(tx)
+	return tx
+}
+
 // Execute 请确保dest 是一个指向字节切片的指针。定义var s []byte 使用&s
 // Deprecated: use Ctl().Pod().Command().Execute() instead.
 func (k *Kubectl) Execute(dest interface{}) *Kubectl {
@@ -0,0 +1,144 @@
+package kom
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weibaohui/kom/utils"
+	"github.com/xwb1989/sqlparser"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// bindArgs ? 占位符绑定的参数
+// sqlparser 将sql中的 ? 按出现顺序解析为 :v1、:v2 ...，解析为语法树后再按序号取参数值
+// 参数值不参与sql解析，包含 '、? 等字符时也不会改变sql结构
+type bindArgs []interface{}
+
+// lookup 表达式为占位符时，返回绑定的参数值
+func (a bindArgs) lookup(expr sqlparser.Expr) (interface{}, bool, error) {
+	v, ok := expr.(*sqlparser.SQLVal)
+	if !ok || v.Type != sqlparser.ValArg {
+		return nil, false, nil
+	}
+	index, err := strconv.Atoi(strings.TrimPrefix(string(v.Val), ":v"))
+	if err != nil || index < 1 || index > len(a) {
+		return nil, false, fmt.Errorf("no value bound for placeholder %s, got %d values", v.Val, len(a))
+	}
+	return a[index-1], true, nil
+}
+
+// check 检查占位符数量与参数数量是否一致
+func (a bindArgs) check(stmt sqlparser.SQLNode) error {
+	count := 0
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if v, ok := node.(*sqlparser.SQLVal); ok && v.Type == sqlparser.ValArg {
+			count++
+		}
+		return true, nil
+	}, stmt)
+	if count != len(a) {
+		return fmt.Errorf("sql has %d placeholders but %d values were given", count, len(a))
+	}
+	return nil
+}
+
+// bindValue 按参数的Go类型确定条件值及类型
+// 字符串不做类型探测，大小比较时再按字面量的规则探测，见 orderingConditionValue，数字统一转换为float64，时间保持time.Time，time.Duration转换为秒数，resource.Quantity按资源数量比较
+func bindValue(value interface{}) (string, interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil, fmt.Errorf("nil value can not be bound")
+	case string:
+		return utils.TypeString, v, nil
+	case bool:
+		return utils.TypeBoolean, v, nil
+	case time.Time:
+		return utils.TypeTime, v, nil
+	case resource.Quantity:
+		return utils.TypeQuantity, v, nil
+	case *resource.Quantity:
+		if v == nil {
+			return "", nil, fmt.Errorf("nil value can not be bound")
+		}
+		return utils.TypeQuantity, *v, nil
+	case time.Duration:
+		// 时长按秒数比较，与age()的值一致
+		return utils.TypeNumber, v.Seconds(), nil
+	case *time.Time:
+		if v == nil {
+			return "", nil, fmt.Errorf("nil value can not be bound")
+		}
+		return utils.TypeTime, *v, nil
+	case metav1.Time:
+		return utils.TypeTime, v.Time, nil
+	case *metav1.Time:
+		if v == nil {
+			return "", nil, fmt.Errorf("nil value can not be bound")
+		}
+		return utils.TypeTime, v.Time, nil
+	case fmt.Stringer:
+		return utils.TypeString, v.String(), nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return utils.TypeNumber, float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return utils.TypeNumber, float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return utils.TypeNumber, rv.Float(), nil
+	case reflect.String:
+		// 自定义字符串类型，如 v1.PodPhase
+		return utils.TypeString, rv.String(), nil
+	case reflect.Bool:
+		return utils.TypeBoolean, rv.Bool(), nil
+	}
+	return "", nil, fmt.Errorf("unsupported bind value type %T", value)
+}
+
+// wrapInPlaceholder 将 in ? 转换为 in (?)，sqlparser 只支持括号形式，绑定切片参数时展开为多个值
+// 引号内的内容保持不变
+func wrapInPlaceholder(sql string) string {
+	var sb strings.Builder
+	var quote byte
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		if quote != 0 {
+			if c == '\\' && i+1 < len(sql) {
+				sb.WriteByte(c)
+				i++
+				sb.WriteByte(sql[i])
+				continue
+			}
+			if c == quote {
+				quote = 0
+			}
+			sb.WriteByte(c)
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+		case 'i', 'I':
+			if (i == 0 || !isWordChar(sql[i-1])) && i+2 < len(sql) && (sql[i+1] == 'n' || sql[i+1] == 'N') && !isWordChar(sql[i+2]) {
+				j := i + 2
+				for j < len(sql) && (sql[j] == ' ' || sql[j] == '\t' || sql[j] == '\n' || sql[j] == '\r') {
+					j++
+				}
+				if j < len(sql) && sql[j] == '?' {
+					sb.WriteString(sql[i:j])
+					sb.WriteString("(?)")
+					i = j
+					continue
+				}
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
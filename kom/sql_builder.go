@@ -2,7 +2,6 @@ package kom
 
 import (
 	"fmt"
-	"log"
 	"strings"
 
 	"github.com/weibaohui/kom/utils"
@@ -10,22 +9,42 @@ import (
 	"k8s.io/klog/v2"
 )
 
-// Sql TODO Insert Update Delete
+// Sql 解析sql为函数调用，实现支持原生sql语句
 //
-//	 已支持Select
-//		解析sql为函数调用，实现支持原生sql语句
+//	已支持Select、Update、Delete
 //
-// select * from pod where pod.name='?', 'abc'
+// select * from pod where metadata.name=?, 'abc' 参数在解析为语法树后绑定，in (?) 或 in ? 可绑定切片
+// select metadata.name as name, status.phase from pod 指定查询字段时，返回字段值组成的行
+// select spec.nodeName, count(*) as total from pod group by spec.nodeName having count(*) > 10 聚合查询，返回分组后的行
+// select p.metadata.name, n.metadata.labels.zone from pod p join node n on p.spec.nodeName = n.metadata.name 关联查询，字段需带上表别名
+// update deployment set spec.replicas=0 where metadata.labels.env='dev' 需调用Exec执行，逐个对象执行Patch
+// delete from pod where status.phase='Failed' and metadata.namespace='ci' 需调用Exec执行，逐个对象执行Delete
+// explain select * from pod where status.phase='Running' 调用List返回执行计划，也可以对任意语句调用Explain获取执行计划
 func (k *Kubectl) Sql(sql string, values ...interface{}) *Kubectl {
 	tx := k.getInstance()
 	tx.AllNamespace()
 
-	sql = formatSql(sql, values)
+	// explain select ... 只生成执行计划
+	if loc := explainPrefix.FindStringIndex(sql); loc != nil {
+		sql = sql[loc[1]:]
+		tx.Statement.Filter.Explain = true
+	}
+	tx.Statement.Filter.Sql = sql
+
+	// ? 占位符在解析为语法树后绑定参数值
+	sql = wrapInPlaceholder(sql)
+	args := bindArgs(values)
+
+	// 为包含[]或超过三级的字段路径添加反引号，如 metadata.labels['app.kubernetes.io/name']
+	sql = quoteFieldPaths(sql)
 
 	// 添加反引号，将metadata.name 转为`metadata.name`,
 	// k8s中很多类似json的字段，需要用反引号进行包裹，避免被作为db.table形式使用
 	// sql = NewSqlParse(sql).AddBackticks()
 
+	// order by 子句由kom解析，支持多字段排序及 nulls first、nulls last
+	sql, order := splitOrderBy(sql)
+
 	stmt, err := sqlparser.Parse(sql)
 	if err != nil {
 		klog.Errorf("Error parsing SQL:%s,%v", sql, err)
@@ -33,54 +52,195 @@ func (k *Kubectl) Sql(sql string, values ...interface{}) *Kubectl {
 		return tx
 	}
 
-	var conditions []Condition // 存储解析后的条件
+	err = args.check(stmt)
+	if err == nil {
+		switch stmt := stmt.(type) {
+		case *sqlparser.Select:
+			err = tx.parseSelectStmt(stmt, args)
+		case *sqlparser.Update:
+			err = tx.parseUpdateStmt(stmt, args)
+		case *sqlparser.Delete:
+			err = tx.parseDeleteStmt(stmt, args)
+		default:
+			err = fmt.Errorf("unsupported sql statement: %s", sql)
+		}
+	}
+	if err != nil {
+		klog.Errorf("Error parsing SQL:%s,%v", sql, err)
+		tx.Error = err
+		return tx
+	}
 
-	// 断言为 *sqlparser.Select 类型
-	selectStmt, ok := stmt.(*sqlparser.Select)
-	if !ok {
-		log.Fatalf("Not a SELECT statement")
+	// 设置排序字段
+	if order != "" {
+		tx.Statement.Filter.Order = "order by " + order
 	}
+
+	tx.Statement.Filter.Parsed = true
+	return tx
+}
+
+// parseSelectStmt 解析select语句
+func (k *Kubectl) parseSelectStmt(selectStmt *sqlparser.Select, args bindArgs) error {
 	// 获取 Select 语句中的 From 作为Resource
-	from := sqlparser.String(selectStmt.From)
+	table, joins, err := parseFrom(selectStmt.From)
+	if err != nil {
+		return err
+	}
+	if err = k.sqlTable(table.Table); err != nil {
+		return err
+	}
+
+	// 关联查询的表
+	if len(joins) > 0 {
+		for i, join := range joins {
+			joinGVK := k.Tools().FindGVKByTableNameInApiResources(join.Table)
+			if joinGVK == nil {
+				return fmt.Errorf("resource %s not found both in api-resource and crd", join.Table)
+			}
+			joins[i].GVK = *joinGVK
+		}
+		k.Statement.Filter.Alias = table.Alias
+		k.Statement.Filter.Joins = joins
+	}
+
+	// 解析查询字段
+	columns, err := parseSelectExprs(selectStmt.SelectExprs)
+	if err != nil {
+		return err
+	}
+	k.Statement.Filter.setProjections(columns)
+
+	if err = k.sqlLimit(selectStmt.Limit, args); err != nil {
+		return err
+	}
+	// 解析Where语句，获得执行条件
+	if err = k.sqlWhere(selectStmt.Where, args); err != nil {
+		return err
+	}
+
+	// 解析分组及分组后的过滤条件
+	k.Statement.Filter.GroupBy = parseGroupBy(selectStmt.GroupBy)
+	if selectStmt.Having != nil {
+		having, err := parseWhereExpr(0, "AND", selectStmt.Having.Expr, args)
+		if err != nil {
+			return err
+		}
+		k.Statement.Filter.Having = having
+	}
+	return nil
+}
+
+// parseUpdateStmt 解析update语句，set 的字段路径及值存放到Filter.Sets中
+func (k *Kubectl) parseUpdateStmt(updateStmt *sqlparser.Update, args bindArgs) error {
+	if err := k.sqlDmlTable(updateStmt.TableExprs); err != nil {
+		return err
+	}
+	sets, err := parseUpdateExprs(updateStmt.Exprs, args)
+	if err != nil {
+		return err
+	}
+	k.Statement.Filter.Action = SqlActionUpdate
+	k.Statement.Filter.Sets = sets
+	if err = k.sqlLimit(updateStmt.Limit, args); err != nil {
+		return err
+	}
+	return k.sqlWhere(updateStmt.Where, args)
+}
+
+// parseDeleteStmt 解析delete语句
+func (k *Kubectl) parseDeleteStmt(deleteStmt *sqlparser.Delete, args bindArgs) error {
+	if len(deleteStmt.Targets) > 0 {
+		return fmt.Errorf("delete 不支持指定删除目标表")
+	}
+	if err := k.sqlDmlTable(deleteStmt.TableExprs); err != nil {
+		return err
+	}
+	k.Statement.Filter.Action = SqlActionDelete
+	if err := k.sqlLimit(deleteStmt.Limit, args); err != nil {
+		return err
+	}
+	return k.sqlWhere(deleteStmt.Where, args)
+}
+
+// sqlDmlTable 解析update、delete语句的表，只支持单表
+func (k *Kubectl) sqlDmlTable(tableExprs sqlparser.TableExprs) error {
+	table, joins, err := parseFrom(tableExprs)
+	if err != nil {
+		return err
+	}
+	if len(joins) > 0 {
+		return fmt.Errorf("update、delete 不支持关联查询")
+	}
+	if _, ok := GetVirtualTable(table.Table); ok {
+		return fmt.Errorf("虚拟表 %s 只支持查询", table.Table)
+	}
+	return k.sqlTable(table.Table)
+}
+
+// sqlTable 根据表名设置GVK
+func (k *Kubectl) sqlTable(from string) error {
 	gvk := k.Tools().FindGVKByTableNameInApiResources(from)
 	if gvk == nil {
-		tx.Error = fmt.Errorf("resource %s not found both in api-resource and crd", from)
 		klog.V(6).Infof("resource %s not found both in api-resource and crd", from)
 		names := k.Tools().ListAvailableTableNames()
 		klog.V(6).Infof("Available resource: %s", names)
-		return tx
+		return fmt.Errorf("resource %s not found both in api-resource and crd", from)
 	}
-
+	k.Statement.Filter.From = from
+	k.Statement.Filter.Virtual, _ = GetVirtualTable(from)
 	// 设置GVK
-	tx.GVK(gvk.Group, gvk.Version, gvk.Kind)
-
-	// 获取 LIMIT 子句信息
-	limit := selectStmt.Limit
-	if limit != nil {
-		// 获取 LIMIT 的 Rowcount 和 Offset
-		rowCount := sqlparser.String(limit.Rowcount)
-		offset := sqlparser.String(limit.Offset)
+	k.GVK(gvk.Group, gvk.Version, gvk.Kind)
+	return nil
+}
 
-		tx.Limit(utils.ToInt(rowCount))
-		tx.Offset(utils.ToInt(offset))
+// sqlLimit 获取 LIMIT 子句信息
+func (k *Kubectl) sqlLimit(limit *sqlparser.Limit, args bindArgs) error {
+	if limit == nil {
+		return nil
 	}
-	// 解析Where语句，活的执行条件
-	conditions = parseWhereExpr(conditions, 0, "AND", selectStmt.Where.Expr)
-
-	// 探测 conditions中的条件值类型
-	for i, cond := range conditions {
-		conditions[i].ValueType, conditions[i].Value = utils.DetectType(cond.Value)
+	// 获取 LIMIT 的 Rowcount 和 Offset，支持 limit ?, ? 绑定参数
+	rowCount, err := limitValue(limit.Rowcount, args)
+	if err != nil {
+		return err
+	}
+	offset, err := limitValue(limit.Offset, args)
+	if err != nil {
+		return err
 	}
-	tx.Statement.Filter.Conditions = conditions
 
-	// 设置排序字段
-	orderBy := selectStmt.OrderBy
-	if orderBy != nil {
-		tx.Statement.Filter.Order = sqlparser.String(orderBy)
+	k.Limit(rowCount)
+	k.Offset(offset)
+	return nil
+}
+
+// limitValue 获取limit、offset的值
+func limitValue(expr sqlparser.Expr, args bindArgs) (int, error) {
+	if expr == nil {
+		return 0, nil
 	}
+	arg, ok, err := args.lookup(expr)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return utils.ToInt(fmt.Sprintf("%v", arg)), nil
+	}
+	return utils.ToInt(sqlparser.String(expr)), nil
+}
 
-	tx.Statement.Filter.Parsed = true
-	return tx
+// sqlWhere 解析Where语句，获得执行条件
+func (k *Kubectl) sqlWhere(where *sqlparser.Where, args bindArgs) error {
+	if where == nil {
+		return nil
+	}
+	expr, err := parseWhereExpr(0, "AND", where.Expr, args)
+	if err != nil {
+		return err
+	}
+	k.Statement.Filter.WhereExpr = expr
+	k.Statement.Filter.Conditions = expr.Flatten()
+	return nil
 }
 
 func (k *Kubectl) From(tableName string) *Kubectl {
@@ -94,6 +254,7 @@ func (k *Kubectl) From(tableName string) *Kubectl {
 		return tx
 	}
 	tx.Statement.Filter.From = tableName
+	tx.Statement.Filter.Virtual, _ = GetVirtualTable(tableName)
 	// 设置GVK
 	tx.GVK(gvk.Group, gvk.Version, gvk.Kind)
 	return tx
@@ -101,17 +262,22 @@ func (k *Kubectl) From(tableName string) *Kubectl {
 func (k *Kubectl) Where(condition string, values ...interface{}) *Kubectl {
 	tx := k.getInstance()
 	originalSql := tx.Statement.Filter.Sql
-	sql := formatSql(condition, values)
+	// ? 占位符在解析为语法树后绑定参数值
+	sql := quoteFieldPaths(wrapInPlaceholder(condition))
+	args := bindArgs(values)
 
 	trimSql := strings.ReplaceAll(sql, " ", "")
 	if trimSql == "(())" || trimSql == "()" || trimSql == "" {
 		// 没有内容
 		return tx
 	}
+	// 每次只解析本次传入的条件，再与之前的条件表达式使用AND连接
+	// 这样无论之前是通过Sql()还是Where()设置的条件，都能正确叠加
+	whereSql := fmt.Sprintf(" select * from fake where ( %s )", sql)
 	if originalSql != "" {
 		sql = originalSql + " and ( " + sql + " ) "
 	} else {
-		sql = fmt.Sprintf(" select * from fake where ( %s )", sql)
+		sql = whereSql
 	}
 
 	// 添加反引号，将metadata.name 转为`metadata.name`,
@@ -120,58 +286,112 @@ func (k *Kubectl) Where(condition string, values ...interface{}) *Kubectl {
 
 	tx.Statement.Filter.Sql = sql
 
-	stmt, err := sqlparser.Parse(sql)
+	stmt, err := sqlparser.Parse(whereSql)
 	if err != nil {
 		klog.Errorf("Error parsing SQL:%s,%v", sql, err)
 		tx.Error = err
 		return tx
 	}
 
-	var conditions []Condition // 存储解析后的条件
-
 	// 断言为 *sqlparser.Select 类型
 	selectStmt, ok := stmt.(*sqlparser.Select)
 	if !ok {
+		err = fmt.Errorf("not select statement: %s", sql)
 		klog.Errorf("not select parsing SQL:%s,%v", sql, err)
 		tx.Error = err
 		return tx
 	}
+	if err = args.check(stmt); err != nil {
+		klog.Errorf("Error binding SQL:%s,%v", sql, err)
+		tx.Error = err
+		return tx
+	}
 
 	// 解析Where语句，获得执行条件
-	conditions = parseWhereExpr(conditions, 0, "AND", selectStmt.Where.Expr)
-
-	// 探测 conditions中的条件值类型
-	for i, cond := range conditions {
-		conditions[i].ValueType, conditions[i].Value = utils.DetectType(cond.Value)
+	expr, err := parseWhereExpr(0, "AND", selectStmt.Where.Expr, args)
+	if err != nil {
+		klog.Errorf("Error parsing SQL where:%s,%v", sql, err)
+		tx.Error = err
+		return tx
 	}
 
-	tx.Statement.Filter.Conditions = conditions
+	tx.Statement.Filter.WhereExpr = andConditionExpr(tx.Statement.Filter.WhereExpr, expr)
+	tx.Statement.Filter.Conditions = tx.Statement.Filter.WhereExpr.Flatten()
 
 	tx.Statement.Filter.Parsed = true
 
 	return tx
 }
 
-// formatSql
-//
-//	select * from pod where pod.name='?', 'abc'
-func formatSql(condition string, values []interface{}) string {
-	// 将 values 替换到 condition 中的占位符 ?
-	for _, value := range values {
-		// 对值进行安全格式化，例如字符串加单引号
-		switch v := value.(type) {
-		case string:
-			condition = strings.Replace(condition, "?", fmt.Sprintf("'%s'", v), 1)
-		default:
-			condition = strings.Replace(condition, "?", fmt.Sprintf("%v", v), 1)
-		}
+// Select 设置查询字段，支持别名及嵌套路径
+// Select("metadata.name as name", "status.phase")
+// 设置查询字段后，List 结果为字段值组成的行，可使用 []map[string]interface{} 或带有对应json tag的结构体承载
+func (k *Kubectl) Select(columns ...string) *Kubectl {
+	tx := k.getInstance()
+	sql := quoteFieldPaths(fmt.Sprintf("select %s from fake", strings.Join(columns, ", ")))
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		klog.Errorf("Error parsing SQL:%s,%v", sql, err)
+		tx.Error = err
+		return tx
+	}
+	selectStmt, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		tx.Error = fmt.Errorf("not select statement: %s", sql)
+		return tx
+	}
+	cols, err := parseSelectExprs(selectStmt.SelectExprs)
+	if err != nil {
+		tx.Error = err
+		return tx
+	}
+	tx.Statement.Filter.setProjections(cols)
+	return tx
+}
+
+// GroupBy 设置分组字段，配合 Select 中的聚合函数使用
+// Select("spec.nodeName", "count(*) as total").GroupBy("spec.nodeName")
+func (k *Kubectl) GroupBy(fields ...string) *Kubectl {
+	tx := k.getInstance()
+	tx.Statement.Filter.GroupBy = append(tx.Statement.Filter.GroupBy, fields...)
+	return tx
+}
+
+// Having 设置分组后的过滤条件，可引用聚合字段或其别名
+// Having("count(*) > ?", 10)
+func (k *Kubectl) Having(condition string, values ...interface{}) *Kubectl {
+	tx := k.getInstance()
+	sql := fmt.Sprintf(" select * from fake group by fake having ( %s )", quoteFieldPaths(wrapInPlaceholder(condition)))
+	args := bindArgs(values)
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		klog.Errorf("Error parsing SQL:%s,%v", sql, err)
+		tx.Error = err
+		return tx
+	}
+	selectStmt, ok := stmt.(*sqlparser.Select)
+	if !ok || selectStmt.Having == nil {
+		tx.Error = fmt.Errorf("not having condition: %s", condition)
+		return tx
 	}
-	return condition
+	if err = args.check(stmt); err != nil {
+		tx.Error = err
+		return tx
+	}
+	expr, err := parseWhereExpr(0, "AND", selectStmt.Having.Expr, args)
+	if err != nil {
+		tx.Error = err
+		return tx
+	}
+	tx.Statement.Filter.Having = andConditionExpr(tx.Statement.Filter.Having, expr)
+	return tx
 }
 
 // Order
 // Order(" id desc")
 // Order(" date asc")
+// Order("metadata.namespace asc, metadata.creationTimestamp desc") 多字段排序，依次按各字段比较
+// Order("spec.nodeName asc nulls first") 字段不存在的对象排在最前，默认升序时排在最后，降序时排在最前
 func (k *Kubectl) Order(order string) *Kubectl {
 	tx := k.getInstance()
 	tx.Statement.Filter.Order = order
@@ -0,0 +1,234 @@
+package kom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+)
+
+// ClusterColumn 多集群查询时对象上的虚拟字段，值为对象所在的集群ID
+// 可用于where、order by、group by及查询字段，如 select cluster, count(*) from pod group by cluster
+const ClusterColumn = "cluster"
+
+// ClusterReport 多集群查询中单个集群的执行情况
+type ClusterReport struct {
+	Cluster  string        `json:"cluster"`
+	Skipped  bool          `json:"skipped,omitempty"` // where 中的 cluster 条件排除了该集群，未查询
+	Count    int           `json:"count"`             // 满足where条件的对象数量
+	Duration time.Duration `json:"duration"`          // 查询耗时
+	Error    error         `json:"-"`                 // 查询失败的原因，不影响其他集群的结果
+}
+
+// MultiCluster 多集群sql查询
+// 并发在各集群上执行查询，对象上增加虚拟字段cluster，合并后再统一执行分组聚合、排序及limit
+//
+//	var list []map[string]interface{}
+//	var report []kom.ClusterReport
+//	err := kom.Sql("select cluster, metadata.namespace, metadata.name from pod where cluster in ('prod-a','prod-b') and status.phase='Pending' order by cluster").
+//		FillReport(&report).List(&list).Error
+type MultiCluster struct {
+	ids      []string
+	sql      string
+	values   []interface{}
+	ctx      context.Context
+	cacheTTL time.Duration
+	report   *[]ClusterReport
+	Error    error
+}
+
+// Sql 在全部已注册的集群上执行sql查询，可通过 where cluster in (...) 限定集群
+func Sql(sql string, values ...interface{}) *MultiCluster {
+	return MultiClusters().Sql(sql, values...)
+}
+
+// MultiClusters 在指定的集群上执行查询，不传ids时为全部已注册的集群
+func MultiClusters(ids ...string) *MultiCluster {
+	return &MultiCluster{ids: ids, ctx: context.Background()}
+}
+
+// Sql 设置查询语句，仅支持select
+func (m *MultiCluster) Sql(sql string, values ...interface{}) *MultiCluster {
+	m.sql = sql
+	m.values = values
+	return m
+}
+
+func (m *MultiCluster) WithContext(ctx context.Context) *MultiCluster {
+	m.ctx = ctx
+	return m
+}
+
+func (m *MultiCluster) WithCache(ttl time.Duration) *MultiCluster {
+	m.cacheTTL = ttl
+	return m
+}
+
+// FillReport 查询后填充各集群的执行情况，按集群ID排序
+func (m *MultiCluster) FillReport(report *[]ClusterReport) *MultiCluster {
+	m.report = report
+	return m
+}
+
+// List 执行查询，将合并后的结果填充到dest中
+// 单个集群查询失败时记录到执行情况中，不影响其他集群，全部集群均失败时返回错误
+func (m *MultiCluster) List(dest interface{}) *MultiCluster {
+	if m.Error != nil {
+		return m
+	}
+	ids := append([]string{}, m.ids...)
+	if len(ids) == 0 {
+		for id := range Clusters().AllClusters() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) == 0 {
+		m.Error = fmt.Errorf("no cluster registered")
+		return m
+	}
+
+	reports := make([]ClusterReport, len(ids))
+	parsed := make([]*Kubectl, len(ids))
+	items := make([][]unstructured.Unstructured, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		reports[i].Cluster = id
+		tx, err := m.clusterInstance(id)
+		if err != nil {
+			reports[i].Error = err
+			continue
+		}
+		if !clusterSelected(tx.Statement.Filter.WhereExpr, id) {
+			reports[i].Skipped = true
+			continue
+		}
+		parsed[i] = tx
+		wg.Add(1)
+		go func(i int, tx *Kubectl) {
+			defer wg.Done()
+			start := time.Now()
+			items[i], reports[i].Error = tx.listClusterItems()
+			reports[i].Count = len(items[i])
+			reports[i].Duration = time.Since(start)
+		}(i, tx)
+	}
+	wg.Wait()
+
+	// 合并各集群的结果，在第一个成功的集群上统一执行分组聚合、排序及limit
+	var merge *Kubectl
+	var errs []error
+	all := make([]unstructured.Unstructured, 0)
+	for i, r := range reports {
+		if r.Error != nil {
+			klog.V(6).Infof("multi cluster sql on %s error: %v", r.Cluster, r.Error)
+			errs = append(errs, fmt.Errorf("%s: %w", r.Cluster, r.Error))
+			continue
+		}
+		if r.Skipped {
+			continue
+		}
+		if merge == nil {
+			merge = parsed[i]
+		}
+		all = append(all, items[i]...)
+	}
+	if m.report != nil {
+		*m.report = reports
+	}
+	if merge == nil {
+		if len(errs) > 0 {
+			m.Error = errors.Join(errs...)
+		} else {
+			m.Error = fmt.Errorf("no cluster matched")
+		}
+		return m
+	}
+
+	stmt := *merge.Statement
+	stmt.Filter.WhereExpr = nil
+	stmt.Items = all
+	tx := &Kubectl{ID: merge.ID, Statement: &stmt}
+	m.Error = tx.List(dest).Error
+	return m
+}
+
+// clusterInstance 在集群上解析sql
+func (m *MultiCluster) clusterInstance(id string) (*Kubectl, error) {
+	k := Cluster(id)
+	if k == nil {
+		return nil, fmt.Errorf("cluster %s not found", id)
+	}
+	tx := k.WithContext(m.ctx).WithCache(m.cacheTTL).Sql(m.sql, m.values...)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	filter := tx.Statement.Filter
+	if filter.Explain || filter.Action != "" {
+		return nil, fmt.Errorf("multi cluster sql only supports select")
+	}
+	return tx, nil
+}
+
+// listClusterItems 在单个集群上执行关联及where过滤，返回带有cluster字段的对象
+// 分组聚合、查询字段在合并后执行，非聚合查询在各集群先排序并截取前 offset+limit 个对象
+func (k *Kubectl) listClusterItems() ([]unstructured.Unstructured, error) {
+	stmt := *k.Statement
+	filter := &stmt.Filter
+	if filter.IsAggregate() {
+		filter.Order = ""
+		filter.Limit = 0
+	} else if filter.Limit > 0 {
+		filter.Limit += filter.Offset
+	}
+	filter.Offset = 0
+	filter.Columns = nil
+	filter.Projections = nil
+	filter.GroupBy = nil
+	filter.Having = nil
+	filter.Cluster = true
+
+	var items []unstructured.Unstructured
+	tx := &Kubectl{ID: k.ID, Statement: &stmt}
+	err := tx.List(&items).Error
+	return items, err
+}
+
+// clusterSelected 根据where中顶层AND连接的 cluster='x'、cluster in ('x','y') 条件判断是否需要查询该集群
+func clusterSelected(expr *ConditionExpr, id string) bool {
+	if expr == nil {
+		return true
+	}
+	var conjuncts []*ConditionExpr
+	if expr.Logic == "AND" {
+		conjuncts = expr.Children
+	} else {
+		conjuncts = []*ConditionExpr{expr}
+	}
+	for _, c := range conjuncts {
+		if c.Condition == nil || c.Condition.Field != ClusterColumn || c.Condition.Subquery != nil {
+			continue
+		}
+		values, ok := stringValues(c.Condition)
+		if !ok {
+			continue
+		}
+		matched := false
+		for _, v := range values {
+			// 与本地 =、in 的比较一致，不区分大小写
+			if strings.EqualFold(v, id) {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
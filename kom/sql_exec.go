@@ -0,0 +1,157 @@
+package kom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// Preview 预览 update、delete 语句匹配的对象
+// 调用Exec时只返回匹配的对象，不执行修改，RowsAffected为将受影响的对象数量
+func (k *Kubectl) Preview() *Kubectl {
+	tx := k.getInstance()
+	tx.Statement.Filter.Preview = true
+	return tx
+}
+
+// Exec 执行sql中的 update、delete 语句
+// 先按where条件查询匹配的对象，再逐个调用Patch、Delete执行，注册的回调照常触发
+// 单个对象失败不会中断执行，每个对象的执行结果存放在results中，results可以为nil
+// RowsAffected 为执行成功的对象数量，有对象执行失败时，Error 中包含全部失败原因
+//
+//	var results []kom.ExecResult
+//	err := kom.DefaultCluster().Sql("delete from pod where status.phase='Failed' and metadata.namespace='ci'").Exec(&results).Error
+//	err = kom.DefaultCluster().Sql("update deployment set spec.replicas=0 where metadata.labels.env='dev'").Preview().Exec(&results).Error
+func (k *Kubectl) Exec(results *[]ExecResult) *Kubectl {
+	tx := k.getInstance()
+	if tx.Error != nil {
+		return tx
+	}
+	filter := tx.Statement.Filter
+	if filter.Explain {
+		tx.Error = fmt.Errorf("explain 语句请使用 Explain 获取执行计划")
+		return tx
+	}
+	if filter.Action != SqlActionUpdate && filter.Action != SqlActionDelete {
+		tx.Error = fmt.Errorf("Exec 仅支持 update、delete 语句")
+		return tx
+	}
+
+	var patchData string
+	if filter.Action == SqlActionUpdate {
+		data, err := buildPatchData(filter.Sets)
+		if err != nil {
+			tx.Error = err
+			return tx
+		}
+		patchData = data
+	}
+
+	// 查询匹配的对象
+	var items []unstructured.Unstructured
+	if err := tx.List(&items).Error; err != nil {
+		tx.Error = err
+		return tx
+	}
+
+	var errs []error
+	var affected int64
+	var execResults []ExecResult
+	for _, item := range items {
+		result := ExecResult{Namespace: item.GetNamespace(), Name: item.GetName()}
+		if !filter.Preview {
+			inst := tx.objectInstance(&item)
+			if filter.Action == SqlActionUpdate {
+				var res unstructured.Unstructured
+				result.Error = inst.Patch(&res, types.MergePatchType, patchData).Error
+			} else {
+				result.Error = inst.Delete().Error
+			}
+		}
+		if result.Error != nil {
+			klog.V(6).Infof("sql %s %s/%s error: %v", filter.Action, result.Namespace, result.Name, result.Error)
+			errs = append(errs, fmt.Errorf("%s/%s: %w", result.Namespace, result.Name, result.Error))
+		} else {
+			affected++
+		}
+		execResults = append(execResults, result)
+	}
+
+	if results != nil {
+		*results = execResults
+	}
+	tx.Statement.RowsAffected = affected
+	if len(errs) > 0 {
+		tx.Error = fmt.Errorf("%s %d/%d 个对象执行失败: %w", filter.Action, len(errs), len(items), errors.Join(errs...))
+	}
+	return tx
+}
+
+// objectInstance 获取针对单个对象操作的实例，沿用当前的GVK、GVR、上下文及写操作选项（强制删除、试运行、field manager）
+func (k *Kubectl) objectInstance(obj *unstructured.Unstructured) *Kubectl {
+	tx := k.newInstance()
+	tx.Statement.GVK = k.Statement.GVK
+	tx.Statement.GVR = k.Statement.GVR
+	tx.Statement.Namespaced = k.Statement.Namespaced
+	tx.Statement.useCustomGVK = k.Statement.useCustomGVK
+	tx.Statement.ForceDelete = k.Statement.ForceDelete
+	tx.Statement.DryRun = k.Statement.DryRun
+	tx.Statement.FieldManager = k.Statement.FieldManager
+	tx.Statement.Namespace = obj.GetNamespace()
+	tx.Statement.Name = obj.GetName()
+	return tx
+}
+
+// buildPatchData 将set字段转换为合并patch
+// spec.replicas=0, metadata.labels.env='prod' 转换为 {"metadata":{"labels":{"env":"prod"}},"spec":{"replicas":0}}
+// 字段路径按 ParseFieldPath 解析，metadata.labels['app.kubernetes.io/name'] 中的key作为一级
+// 合并patch无法修改数组中的单个元素，set 字段不支持数组下标、[*] 及筛选
+func buildPatchData(sets []SetField) (string, error) {
+	if len(sets) == 0 {
+		return "", fmt.Errorf("update 语句缺少 set 字段")
+	}
+	patch := map[string]interface{}{}
+	for _, set := range sets {
+		steps, err := ParseFieldPath(set.Field)
+		if err != nil {
+			return "", fmt.Errorf("set 字段 %s 格式错误: %v", set.Field, err)
+		}
+		if len(steps) == 0 {
+			return "", fmt.Errorf("set 字段 %s 格式错误", set.Field)
+		}
+		current := patch
+		for i, step := range steps {
+			if step.Key == "" {
+				return "", fmt.Errorf("set 字段 %s 不支持数组下标及筛选，合并patch只能整体替换数组", set.Field)
+			}
+			if i == len(steps)-1 {
+				if _, exists := current[step.Key]; exists {
+					return "", fmt.Errorf("set 字段 %s 冲突", set.Field)
+				}
+				current[step.Key] = set.Value
+				break
+			}
+			next, exists := current[step.Key]
+			if !exists {
+				child := map[string]interface{}{}
+				current[step.Key] = child
+				current = child
+				continue
+			}
+			child, ok := next.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("set 字段 %s 冲突", set.Field)
+			}
+			current = child
+		}
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,180 @@
+package kom
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// explainPrefix sql开头的 explain 关键字
+var explainPrefix = regexp.MustCompile(`(?i)^\s*explain\s+`)
+
+// 执行计划中的命名空间范围
+const (
+	ExplainScopeCluster    = "cluster"    // 集群级资源，不区分命名空间
+	ExplainScopeAll        = "all"        // 查询全部命名空间
+	ExplainScopeNamespaces = "namespaces" // 逐个查询Namespaces中的命名空间
+)
+
+// ExplainPlan sql的执行计划，说明kom将如何执行查询，不会真正查询资源
+type ExplainPlan struct {
+	Sql            string                      `json:"sql,omitempty"`            // 原始sql
+	Action         string                      `json:"action,omitempty"`         // select、update、delete
+	Table          string                      `json:"table,omitempty"`          // 表名
+	Unnest         string                      `json:"unnest,omitempty"`         // 虚拟表展开的父资源数组字段
+	GVK            schema.GroupVersionKind     `json:"GVK"`                      // 表名解析得到的资源类型
+	GVR            schema.GroupVersionResource `json:"GVR"`                      // 查询使用的资源
+	Namespaced     bool                        `json:"namespaced"`               // 是否是命名空间资源
+	NamespaceScope string                      `json:"namespaceScope,omitempty"` // cluster、all、namespaces
+	Namespaces     []string                    `json:"namespaces,omitempty"`     // 逐个查询的命名空间
+	LabelSelector  string                      `json:"labelSelector,omitempty"`  // 发送给api server的label selector
+	FieldSelector  string                      `json:"fieldSelector,omitempty"`  // 发送给api server的field selector
+	Pushed         []string                    `json:"pushed,omitempty"`         // 下推到api server的条件
+	Residual       string                      `json:"residual,omitempty"`       // 在本地过滤的条件
+	Subqueries     []ExplainPlan               `json:"subqueries,omitempty"`     // 条件中子查询的执行计划
+	Joins          []Join                      `json:"joins,omitempty"`          // 关联查询的表
+	Projections    []Column                    `json:"projections,omitempty"`    // 查询字段，为空表示select *
+	GroupBy        []string                    `json:"groupBy,omitempty"`        // 分组字段
+	Having         string                      `json:"having,omitempty"`         // 分组后的过滤条件
+	OrderBy        []OrderField                `json:"orderBy,omitempty"`        // 排序字段
+	DefaultOrder   bool                        `json:"defaultOrder,omitempty"`   // 未指定排序，按创建时间倒序
+	Limit          int                         `json:"limit,omitempty"`
+	Offset         int                         `json:"offset,omitempty"`
+	Informer       bool                        `json:"informer,omitempty"` // 从informer缓存读取，不请求api server
+	CacheTTL       string                      `json:"cacheTTL,omitempty"` // 缓存时间，为空表示不使用缓存
+	CacheKey       string                      `json:"cacheKey,omitempty"` // 列表查询的缓存key
+	CacheHit       bool                        `json:"cacheHit"`           // 当前是否命中缓存
+}
+
+// Explain 获取查询的执行计划，不会真正查询资源
+// 包含表名解析得到的GVK、GVR，命名空间范围，下推到api server的条件与本地过滤的条件，排序字段，limit、offset以及是否命中缓存
+// 子查询不会执行，其条件在执行计划中显示为本地过滤，执行时替换为值列表后仍可能下推
+//
+//	var plan kom.ExplainPlan
+//	err := kom.DefaultCluster().Sql("select * from pod where metadata.namespace='kube-system' and status.phase='Running'").Explain(&plan).Error
+func (k *Kubectl) Explain(plan *ExplainPlan) *Kubectl {
+	tx := k.getInstance()
+	if tx.Error != nil {
+		return tx
+	}
+	p, err := tx.Statement.explain()
+	if err != nil {
+		tx.Error = err
+		return tx
+	}
+	*plan = p
+	return tx
+}
+
+// explain 生成执行计划，与List回调使用相同的条件下推及缓存key
+func (s *Statement) explain() (ExplainPlan, error) {
+	filter := s.Filter
+	plan := ExplainPlan{
+		Sql:         filter.Sql,
+		Action:      filter.Action,
+		Table:       filter.From,
+		GVK:         s.GVK,
+		GVR:         s.GVR,
+		Namespaced:  s.Namespaced,
+		Joins:       filter.Joins,
+		Projections: filter.Projections,
+		GroupBy:     filter.GroupBy,
+		Having:      filter.Having.String(),
+		Limit:       filter.Limit,
+		Offset:      filter.Offset,
+	}
+	if plan.Action == "" {
+		plan.Action = "select"
+	}
+	if filter.Virtual != nil {
+		plan.Unnest = filter.Virtual.Path
+	}
+	if s.GVR.Resource == "" {
+		return plan, fmt.Errorf("resource %s not found both in api-resource and crd", filter.From)
+	}
+
+	// 子查询的执行计划
+	for _, cond := range append(filter.WhereExpr.Flatten(), filter.Having.Flatten()...) {
+		if cond.Subquery == nil {
+			continue
+		}
+		tx, err := s.subqueryInstance(cond.Subquery)
+		if err != nil {
+			return plan, err
+		}
+		sub, err := tx.Statement.explain()
+		if err != nil {
+			return plan, err
+		}
+		sub.Sql = cond.Subquery.Sql
+		plan.Subqueries = append(plan.Subqueries, sub)
+	}
+
+	// 条件下推
+	listOptions := metav1.ListOptions{}
+	if len(s.ListOptions) > 0 {
+		listOptions = s.ListOptions[0]
+	}
+	pushDown := s.PushDownWhere(filter.WhereExpr)
+	listOptions = pushDown.ApplyTo(listOptions)
+	plan.LabelSelector = listOptions.LabelSelector
+	plan.FieldSelector = listOptions.FieldSelector
+	for _, cond := range pushDown.Pushed {
+		plan.Pushed = append(plan.Pushed, cond.String())
+	}
+	plan.Residual = pushDown.Residual.String()
+
+	// 命名空间范围，与List回调的查询方式一致
+	switch {
+	case !s.Namespaced:
+		plan.NamespaceScope = ExplainScopeCluster
+	case len(pushDown.Namespaces) > 0:
+		plan.NamespaceScope = ExplainScopeNamespaces
+		plan.Namespaces = pushDown.Namespaces
+	case s.AllNamespace || len(s.NamespaceList) > 1:
+		plan.NamespaceScope = ExplainScopeAll
+	default:
+		ns := s.Namespace
+		if ns == "" {
+			ns = metav1.NamespaceDefault
+		}
+		plan.NamespaceScope = ExplainScopeNamespaces
+		plan.Namespaces = []string{ns}
+	}
+
+	// 排序
+	if filter.Order != "" {
+		plan.OrderBy = ParseOrderBy(filter.Order)
+	} else if !filter.IsAggregate() && len(filter.Joins) == 0 {
+		plan.DefaultOrder = true
+		plan.OrderBy = []OrderField{{Field: "metadata.creationTimestamp", Desc: true, NullsFirst: true}}
+	}
+
+	// 缓存
+	plan.Informer = s.InformerEnabled()
+	plan.CacheKey = s.ListCacheKey(pushDown, listOptions)
+	if s.CacheTTL > 0 {
+		plan.CacheTTL = s.CacheTTL.String()
+		if cache := s.ClusterCache(); cache != nil {
+			_, plan.CacheHit = cache.Get(plan.CacheKey)
+		}
+	}
+	return plan, nil
+}
+
+// fillExplain 将执行计划作为唯一的结果行填充到dest中
+// Sql("explain select ...").List(&rows) 时使用，dest 可以为 []kom.ExplainPlan 或 []map[string]interface{}
+func (s *Statement) fillExplain(dest interface{}) error {
+	plan, err := s.explain()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal([]ExplainPlan{plan})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dest)
+}
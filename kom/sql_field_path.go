@@ -0,0 +1,128 @@
+package kom
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FieldPathStep 字段路径中的一段
+type FieldPathStep struct {
+	Key      string            // map中的key
+	Index    int               // 数组下标，负数表示从末尾开始，-1 为最后一个元素
+	IsIndex  bool              // 是否为数组下标
+	Wildcard bool              // [*] 数组全部元素
+	Filter   map[string]string // [type=InternalIP] 按元素字段筛选数组
+}
+
+// fieldPathCacheSize 字段路径缓存的最大数量，超过后清空重建
+const fieldPathCacheSize = 1024
+
+var (
+	// fieldPathCache 解析后的字段路径缓存，同一条件会对每个对象求值，避免重复解析
+	fieldPathCache     = make(map[string][]FieldPathStep)
+	fieldPathCacheLock sync.RWMutex
+)
+
+// ParseFieldPath 解析字段路径，where、order by、查询字段、分组、关联字段及update的set字段共用此解析方法
+// 支持以下写法，可以组合使用：
+// metadata.name 以.分隔的多级字段，遇到数组时对每个元素取值
+// metadata.labels['app.kubernetes.io/name'] 使用['key']或["key"]访问包含.、/等字符的key
+// spec.containers[0].image 数组下标，[-1]为最后一个元素
+// spec.containers[*].resources.limits.memory 数组全部元素
+// status.addresses[type=InternalIP].address 按元素字段筛选数组，值可以加引号
+func ParseFieldPath(path string) ([]FieldPathStep, error) {
+	fieldPathCacheLock.RLock()
+	cached, ok := fieldPathCache[path]
+	fieldPathCacheLock.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	var steps []FieldPathStep
+	var key strings.Builder
+	flushKey := func() {
+		if key.Len() > 0 {
+			steps = append(steps, FieldPathStep{Key: key.String()})
+			key.Reset()
+		}
+	}
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '.':
+			flushKey()
+		case '[':
+			flushKey()
+			end := indexBracketEnd(path, i)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid field path %s: unclosed [", path)
+			}
+			step, err := parseBracketStep(strings.TrimSpace(path[i+1 : end]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid field path %s: %v", path, err)
+			}
+			steps = append(steps, step)
+			i = end
+		default:
+			key.WriteByte(c)
+		}
+	}
+	flushKey()
+
+	fieldPathCacheLock.Lock()
+	if len(fieldPathCache) >= fieldPathCacheSize {
+		fieldPathCache = make(map[string][]FieldPathStep)
+	}
+	fieldPathCache[path] = steps
+	fieldPathCacheLock.Unlock()
+	return steps, nil
+}
+
+// indexBracketEnd 查找与start位置的[匹配的]，忽略引号内的内容
+func indexBracketEnd(path string, start int) int {
+	var quote byte
+	for i := start + 1; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseBracketStep 解析[]中的内容，['key']、[0]、[*]、[type=InternalIP]
+func parseBracketStep(content string) (FieldPathStep, error) {
+	switch {
+	case content == "":
+		return FieldPathStep{}, fmt.Errorf("empty []")
+	case content == "*":
+		return FieldPathStep{Wildcard: true}, nil
+	case IsQuoted(content):
+		return FieldPathStep{Key: content[1 : len(content)-1]}, nil
+	}
+	if index, err := strconv.Atoi(content); err == nil {
+		return FieldPathStep{Index: index, IsIndex: true}, nil
+	}
+	if k, v, ok := strings.Cut(content, "="); ok {
+		v = strings.TrimSpace(v)
+		if IsQuoted(v) {
+			v = v[1 : len(v)-1]
+		}
+		return FieldPathStep{Filter: map[string]string{strings.TrimSpace(k): v}}, nil
+	}
+	// 未加引号的key
+	return FieldPathStep{Key: content}, nil
+}
+
+// IsQuoted 是否为单引号或双引号包裹的字符串
+func IsQuoted(s string) bool {
+	return len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]
+}
@@ -0,0 +1,205 @@
+package kom
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weibaohui/kom/utils"
+	"github.com/xwb1989/sqlparser"
+)
+
+// SqlFunc sql标量函数，可用于where、order by及查询字段，如 lower(metadata.name)、len(spec.containers) > 1
+// 参数为各参数表达式的值：字段取到单个值时为该值，取到多个值（数组属性）时为[]interface{}，未取到时为nil，
+// 字符串常量为string，数字常量为float64，嵌套函数为其返回值
+// 返回nil表示没有值，返回[]interface{}时作为多个值参与比较，任意一个满足即可
+// 返回值会转换为JSON值：整数转换为int64，浮点数转换为float64，time.Time转换为RFC3339字符串，其他类型转换为字符串
+type SqlFunc func(args ...interface{}) (interface{}, error)
+
+var (
+	sqlFuncs     = make(map[string]SqlFunc)
+	sqlFuncsLock sync.RWMutex
+)
+
+func init() {
+	RegisterSqlFunc("lower", sqlLower)
+	RegisterSqlFunc("upper", sqlUpper)
+	RegisterSqlFunc("len", sqlLen)
+	RegisterSqlFunc("length", sqlLen)
+	RegisterSqlFunc("split", sqlSplit)
+	RegisterSqlFunc("coalesce", sqlCoalesce)
+	RegisterSqlFunc("age", sqlAge)
+}
+
+// RegisterSqlFunc 注册sql标量函数，函数名不区分大小写，同名函数会覆盖已注册的函数
+//
+//	kom.RegisterSqlFunc("trim", func(args ...interface{}) (interface{}, error) {
+//		if len(args) != 1 {
+//			return nil, fmt.Errorf("trim requires 1 argument")
+//		}
+//		return strings.TrimSpace(fmt.Sprintf("%v", args[0])), nil
+//	})
+//	err := kom.DefaultCluster().Sql("select * from pod where trim(metadata.labels.app) = 'nginx'").List(&list).Error
+func RegisterSqlFunc(name string, fn SqlFunc) {
+	sqlFuncsLock.Lock()
+	defer sqlFuncsLock.Unlock()
+	sqlFuncs[strings.ToLower(name)] = fn
+}
+
+// GetSqlFunc 获取已注册的sql标量函数
+func GetSqlFunc(name string) (SqlFunc, bool) {
+	sqlFuncsLock.RLock()
+	defer sqlFuncsLock.RUnlock()
+	fn, ok := sqlFuncs[strings.ToLower(name)]
+	return fn, ok
+}
+
+// checkFuncs 检查字段表达式中的函数是否为已注册的标量函数或聚合函数
+func checkFuncs(expr sqlparser.SQLNode) error {
+	return sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		fn, ok := node.(*sqlparser.FuncExpr)
+		if !ok {
+			return true, nil
+		}
+		name := fn.Name.Lowered()
+		if isAggregateFunc(name) {
+			return true, nil
+		}
+		if _, ok := GetSqlFunc(name); !ok {
+			return false, fmt.Errorf("unknown function %s", sqlparser.String(fn))
+		}
+		return true, nil
+	}, expr)
+}
+
+// funcArgs 检查参数数量
+func funcArgs(name string, args []interface{}, min, max int) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return fmt.Errorf("%s: wrong number of arguments %d", name, len(args))
+	}
+	return nil
+}
+
+// mapValues 对单个值或多个值中的每一个执行转换，nil 保持为nil
+func mapValues(value interface{}, fn func(v interface{}) interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		results := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if item != nil {
+				results = append(results, fn(item))
+			}
+		}
+		return results
+	}
+	return fn(value)
+}
+
+// sqlLower lower(str) 转换为小写
+func sqlLower(args ...interface{}) (interface{}, error) {
+	if err := funcArgs("lower", args, 1, 1); err != nil {
+		return nil, err
+	}
+	return mapValues(args[0], func(v interface{}) interface{} {
+		return strings.ToLower(fmt.Sprintf("%v", v))
+	}), nil
+}
+
+// sqlUpper upper(str) 转换为大写
+func sqlUpper(args ...interface{}) (interface{}, error) {
+	if err := funcArgs("upper", args, 1, 1); err != nil {
+		return nil, err
+	}
+	return mapValues(args[0], func(v interface{}) interface{} {
+		return strings.ToUpper(fmt.Sprintf("%v", v))
+	}), nil
+}
+
+// sqlLen len(x) 数组的元素个数、map的key个数、字符串的字符数，字段不存在时为0
+func sqlLen(args ...interface{}) (interface{}, error) {
+	if err := funcArgs("len", args, 1, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case nil:
+		return int64(0), nil
+	case []interface{}:
+		return int64(len(v)), nil
+	case map[string]interface{}:
+		return int64(len(v)), nil
+	case string:
+		return int64(len([]rune(v))), nil
+	}
+	return int64(len([]rune(fmt.Sprintf("%v", args[0])))), nil
+}
+
+// sqlSplit split(str, sep) 按分隔符拆分字符串，返回多个值
+// split(str, sep, n) 返回第n个值，从0开始，负数从末尾开始
+func sqlSplit(args ...interface{}) (interface{}, error) {
+	if err := funcArgs("split", args, 2, 3); err != nil {
+		return nil, err
+	}
+	sep := fmt.Sprintf("%v", args[1])
+	var parts []interface{}
+	mapValues(args[0], func(v interface{}) interface{} {
+		for _, p := range strings.Split(fmt.Sprintf("%v", v), sep) {
+			parts = append(parts, p)
+		}
+		return nil
+	})
+	if len(args) == 2 {
+		return parts, nil
+	}
+	index, ok := args[2].(float64)
+	if !ok {
+		return nil, fmt.Errorf("split: index must be a number")
+	}
+	i := int(index)
+	if i < 0 {
+		i += len(parts)
+	}
+	if i < 0 || i >= len(parts) {
+		return nil, nil
+	}
+	return parts[i], nil
+}
+
+// sqlCoalesce coalesce(a, b, ...) 返回第一个不为空的值，如 coalesce(spec.replicas, 1)
+func sqlCoalesce(args ...interface{}) (interface{}, error) {
+	if err := funcArgs("coalesce", args, 1, -1); err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		if list, ok := arg.([]interface{}); ok && len(list) == 0 {
+			continue
+		}
+		if arg != nil {
+			return arg, nil
+		}
+	}
+	return nil, nil
+}
+
+// sqlAge age(time) 时间字段距今的秒数，可与 interval、'7d' 等时长比较，也可用于排序
+func sqlAge(args ...interface{}) (interface{}, error) {
+	if err := funcArgs("age", args, 1, 1); err != nil {
+		return nil, err
+	}
+	var ages []interface{}
+	mapValues(args[0], func(v interface{}) interface{} {
+		if t, err := utils.ParseTime(fmt.Sprintf("%v", v)); err == nil {
+			ages = append(ages, int64(time.Since(t).Seconds()))
+		}
+		return nil
+	})
+	switch len(ages) {
+	case 0:
+		return nil, nil
+	case 1:
+		return ages[0], nil
+	}
+	return ages, nil
+}
@@ -3,56 +3,753 @@ package kom
 import (
 	"fmt"
 	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/weibaohui/kom/utils"
 	"github.com/xwb1989/sqlparser"
 	"k8s.io/klog/v2"
 )
 
-// 解析 WHERE 表达式
-func parseWhereExpr(conditions []Condition, depth int, andor string, expr sqlparser.Expr) []Condition {
+// 解析 WHERE 表达式，构建条件表达式树
+// 括号、AND、OR、NOT 的优先级由sqlparser的语法树保证，这里按语法树结构逐层转换即可
+// args 为 ? 占位符绑定的参数，在语法树上按占位符序号绑定，参数值不会被当作sql解析
+func parseWhereExpr(depth int, andor string, expr sqlparser.Expr, args bindArgs) (*ConditionExpr, error) {
 	klog.V(6).Infof("expr type [%v],string %s, type [%s]", reflect.TypeOf(expr), sqlparser.String(expr), andor)
 	d := depth + 1 // 深度递增
 	switch node := expr.(type) {
 	case *sqlparser.ComparisonExpr:
 		// 处理比较表达式 (比如 age > 80)
+		if err := checkFuncs(node.Left); err != nil {
+			return nil, err
+		}
+		cond := Condition{
+			Depth:    depth,
+			AndOr:    andor,
+			Field:    exprFieldName(node.Left),
+			Operator: node.Operator,
+		}
+		var err error
+		switch node.Operator {
+		case sqlparser.InStr, sqlparser.NotInStr:
+			// in 列表的值为切片，每个元素保持各自的类型
+			cond.ValueType = utils.TypeList
+			if sub, ok := node.Right.(*sqlparser.Subquery); ok {
+				// 子查询在执行查询时解析为值列表
+				cond.Subquery, err = newSubquery(sub, args)
+			} else {
+				cond.Value, err = parseInValues(node.Right, args)
+			}
+		case sqlparser.RegexpStr, sqlparser.NotRegexpStr:
+			// 正则表达式按原始字符串处理，解析时校验，避免执行时才发现错误
+			cond.ValueType = utils.TypeString
+			cond.Value, err = regexpValue(node.Right, args)
+		default:
+			cond.ValueType, cond.Value, err = conditionValue(node.Right, args)
+		}
+		if err != nil {
+			return nil, err
+		}
+		orderingConditionValue(&cond)
+		numberConditionValue(&cond)
+		ageConditionValue(&cond)
+		quantityConditionValue(&cond)
+		return &ConditionExpr{Condition: &cond}, nil
+	case *sqlparser.IsExpr:
+		// 处理 is null、is not null，判断字段是否存在
+		if node.Operator != sqlparser.IsNullStr && node.Operator != sqlparser.IsNotNullStr {
+			return nil, fmt.Errorf("unsupported expression: %s", sqlparser.String(node))
+		}
+		if err := checkFuncs(node.Expr); err != nil {
+			return nil, err
+		}
 		cond := Condition{
 			Depth:    depth,
 			AndOr:    andor,
-			Field:    utils.TrimQuotes(sqlparser.String(node.Left)),
+			Field:    exprFieldName(node.Expr),
 			Operator: node.Operator,
-			Value:    utils.TrimQuotes(sqlparser.String(node.Right)),
 		}
-		conditions = append(conditions, cond)
+		return &ConditionExpr{Condition: &cond}, nil
 	case *sqlparser.ParenExpr:
 		// 处理括号表达式
 		// 括号内的表达式是一个独立的子表达式，增加深度
-		conditions = parseWhereExpr(conditions, d+1, "AND", node.Expr)
-
+		return parseWhereExpr(d+1, "AND", node.Expr, args)
 	case *sqlparser.AndExpr:
 		// 递归解析 AND 表达式
 		// 这里传递 "AND" 给左右两边
-		conditions = parseWhereExpr(conditions, d, "AND", node.Left)
-		conditions = parseWhereExpr(conditions, d, "AND", node.Right)
-	case *sqlparser.RangeCond:
-		// 递归解析 between 1 and 3 表达式
-		cond := Condition{
-			Depth:    depth,
-			AndOr:    andor,
-			Field:    utils.TrimQuotes(sqlparser.String(node.Left)),                                                                        // 左侧的字段
-			Operator: node.Operator,                                                                                                        // 操作符（BETWEEN）
-			Value:    fmt.Sprintf("%s and %s", utils.TrimQuotes(sqlparser.String(node.From)), utils.TrimQuotes(sqlparser.String(node.To))), // 范围值
-		}
-		conditions = append(conditions, cond)
+		return parseLogicExpr(d, "AND", node.Left, node.Right, args)
 	case *sqlparser.OrExpr:
 		// 递归解析 OR 表达式
 		// 这里传递 "OR" 给左右两边
-		conditions = parseWhereExpr(conditions, d, "OR", node.Left)
-		conditions = parseWhereExpr(conditions, d, "OR", node.Right)
+		return parseLogicExpr(d, "OR", node.Left, node.Right, args)
+	case *sqlparser.NotExpr:
+		// 解析 NOT 表达式，对子表达式取反
+		child, err := parseWhereExpr(d, andor, node.Expr, args)
+		if err != nil {
+			return nil, err
+		}
+		return &ConditionExpr{Logic: "NOT", Children: []*ConditionExpr{child}}, nil
+	case *sqlparser.RangeCond:
+		// 递归解析 between 1 and 3 表达式，值为 [from, to]
+		if err := checkFuncs(node.Left); err != nil {
+			return nil, err
+		}
+		from, err := rangeValue(node.From, args)
+		if err != nil {
+			return nil, err
+		}
+		to, err := rangeValue(node.To, args)
+		if err != nil {
+			return nil, err
+		}
+		cond := Condition{
+			Depth:     depth,
+			AndOr:     andor,
+			Field:     exprFieldName(node.Left), // 左侧的字段
+			Operator:  node.Operator,            // 操作符（BETWEEN）
+			Value:     []interface{}{from, to},  // 范围值
+			ValueType: utils.TypeList,
+		}
+		ageConditionValue(&cond)
+		return &ConditionExpr{Condition: &cond}, nil
+	default:
+		// 其他表达式，无法转换为过滤条件，直接报错，避免静默忽略条件导致结果错误
+		return nil, fmt.Errorf("unhandled expression at depth %d: %s", depth, sqlparser.String(expr))
+	}
+}
+
+// parseLogicExpr 解析AND、OR两侧的表达式
+// 同类逻辑满足结合律，连续出现时合并为一个节点，如 a and (b and c) 合并为一个AND节点下的三个子表达式
+func parseLogicExpr(depth int, logic string, left, right sqlparser.Expr, args bindArgs) (*ConditionExpr, error) {
+	node := &ConditionExpr{Logic: logic}
+	for _, e := range []sqlparser.Expr{left, right} {
+		child, err := parseWhereExpr(depth, logic, e, args)
+		if err != nil {
+			return nil, err
+		}
+		if child.Logic == logic {
+			node.Children = append(node.Children, child.Children...)
+			continue
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
+
+// conditionValue 获取比较条件的值及类型
+// 绑定的参数按Go类型确定值类型，sql中的字面量探测类型
+func conditionValue(expr sqlparser.Expr, args bindArgs) (string, interface{}, error) {
+	// now() - interval 7 day 等相对时间，比较时计算
+	if t, ok, err := timeExprValue(expr, args); ok || err != nil {
+		return utils.TypeTime, t, err
+	}
+	if interval, ok := expr.(*sqlparser.IntervalExpr); ok {
+		seconds, err := intervalSeconds(interval, args)
+		return utils.TypeNumber, seconds, err
+	}
+	if arg, ok, err := args.lookup(expr); ok || err != nil {
+		if err != nil {
+			return "", nil, err
+		}
+		valueType, value, err := bindValue(arg)
+		return valueType, value, err
+	}
+	valueType, value := utils.DetectType(literalValue(expr))
+	return valueType, value, nil
+}
 
+// orderingConditionValue 大小比较时，绑定的字符串参数与sql字面量一样探测类型
+// Where("metadata.creationTimestamp > ?", "2024-11-08") 按时间比较，与 > '2024-11-08' 一致
+// 字面量已探测过类型，仍为字符串的值再次探测结果不变
+func orderingConditionValue(cond *Condition) {
+	switch cond.Operator {
+	case ">", "<", ">=", "<=":
 	default:
-		// 其他表达式
-		fmt.Printf("Unhandled expression at depth %d: %s\n", depth, sqlparser.String(expr))
+		return
+	}
+	if str, ok := cond.Value.(string); ok && cond.ValueType == utils.TypeString {
+		cond.ValueType, cond.Value = utils.DetectType(str)
+	}
+}
+
+// numberConditionValue 大小比较的值为1、0时按数字比较
+// DetectType 将1、0识别为布尔值，= 比较时可以匹配布尔字段，如 spec.hostNetwork=1
+// 布尔值不能比较大小，spec.replicas > 1、count(*) >= 1 中的值转换为数字
+func numberConditionValue(cond *Condition) {
+	switch cond.Operator {
+	case ">", "<", ">=", "<=":
+	default:
+		return
+	}
+	if b, ok := cond.Value.(bool); ok && cond.ValueType == utils.TypeBoolean {
+		cond.ValueType = utils.TypeNumber
+		cond.Value = 0.0
+		if b {
+			cond.Value = 1.0
+		}
+	}
+}
+
+// quantityConditionValue 大小比较的值为k8s资源数量时，按resource.Quantity比较
+// spec.containers.resources.requests.memory > '512Mi'、spec.containers.resources.requests.cpu >= '500m'
+func quantityConditionValue(cond *Condition) {
+	switch cond.Operator {
+	case ">", "<", ">=", "<=":
+	default:
+		return
+	}
+	if str, ok := cond.Value.(string); ok && cond.ValueType == utils.TypeString {
+		if q, ok := utils.ParseQuantity(str); ok {
+			cond.ValueType = utils.TypeQuantity
+			cond.Value = q
+		}
+	}
+}
+
+// parseInValues 解析in列表中的值
+// 字符串保持原样，数字转换为float64，绑定的切片参数展开为多个值，如 in (?) 绑定 []string{"a","b"}
+func parseInValues(expr sqlparser.Expr, args bindArgs) ([]interface{}, error) {
+	tuple, ok := expr.(sqlparser.ValTuple)
+	if !ok {
+		return nil, fmt.Errorf("unsupported in values: %s", sqlparser.String(expr))
+	}
+	var values []interface{}
+	for _, e := range tuple {
+		arg, ok, err := args.lookup(e)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if v, isVal := e.(*sqlparser.SQLVal); isVal && (v.Type == sqlparser.IntVal || v.Type == sqlparser.FloatVal) {
+				num, err := strconv.ParseFloat(string(v.Val), 64)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, num)
+				continue
+			}
+			values = append(values, literalValue(e))
+			continue
+		}
+		rv := reflect.ValueOf(arg)
+		if arg != nil && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) {
+			for i := 0; i < rv.Len(); i++ {
+				_, value, err := bindValue(rv.Index(i).Interface())
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, value)
+			}
+			continue
+		}
+		_, value, err := bindValue(arg)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// rangeValue 获取between的边界值，字面量保持原样，由比较时按数字、时间、字符串依次尝试
+func rangeValue(expr sqlparser.Expr, args bindArgs) (interface{}, error) {
+	if t, ok, err := timeExprValue(expr, args); ok || err != nil {
+		return t, err
+	}
+	if interval, ok := expr.(*sqlparser.IntervalExpr); ok {
+		return intervalSeconds(interval, args)
+	}
+	arg, ok, err := args.lookup(expr)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return literalValue(expr), nil
+	}
+	_, value, err := bindValue(arg)
+	return value, err
+}
+
+// regexpValue 获取正则表达式，并校验是否合法
+func regexpValue(expr sqlparser.Expr, args bindArgs) (string, error) {
+	pattern := literalValue(expr)
+	if arg, ok, err := args.lookup(expr); ok || err != nil {
+		if err != nil {
+			return "", err
+		}
+		pattern = fmt.Sprintf("%v", arg)
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return "", fmt.Errorf("invalid regexp %s: %v", pattern, err)
+	}
+	return pattern, nil
+}
+
+// literalValue 获取sql字面量的原始内容，字符串不含引号及转义
+func literalValue(expr sqlparser.Expr) string {
+	if v, ok := expr.(*sqlparser.SQLVal); ok && v.Type == sqlparser.StrVal {
+		return string(v.Val)
+	}
+	return utils.TrimQuotes(sqlparser.String(expr))
+}
+
+// andConditionExpr 使用AND连接两个表达式，任意一个为空时返回另一个
+func andConditionExpr(left, right *ConditionExpr) *ConditionExpr {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	return &ConditionExpr{Logic: "AND", Children: []*ConditionExpr{left, right}}
+}
+
+// parseSelectExprs 解析查询字段
+// select * 时返回空列表，表示返回完整对象
+func parseSelectExprs(exprs sqlparser.SelectExprs) ([]Column, error) {
+	var columns []Column
+	for _, expr := range exprs {
+		switch node := expr.(type) {
+		case *sqlparser.StarExpr:
+			// 出现*，返回完整对象
+			return nil, nil
+		case *sqlparser.AliasedExpr:
+			if err := checkFuncs(node.Expr); err != nil {
+				return nil, err
+			}
+			column := Column{
+				Field: exprFieldName(node.Expr),
+				Alias: node.As.String(),
+			}
+			if fn, ok := node.Expr.(*sqlparser.FuncExpr); ok && isAggregateFunc(fn.Name.Lowered()) {
+				// 聚合函数，如 count(*)、sum(spec.replicas)、sum(len(spec.containers))
+				if len(fn.Exprs) != 1 {
+					return nil, fmt.Errorf("aggregate function %s requires exactly one argument", sqlparser.String(fn))
+				}
+				column.Func = fn.Name.Lowered()
+				column.Field = strings.ReplaceAll(sqlparser.String(fn.Exprs[0]), "`", "")
+				if arg, ok := fn.Exprs[0].(*sqlparser.AliasedExpr); ok {
+					column.Field = exprFieldName(arg.Expr)
+				}
+			}
+			columns = append(columns, column)
+		default:
+			return nil, fmt.Errorf("unhandled select expression: %s", sqlparser.String(expr))
+		}
+	}
+	return columns, nil
+}
+
+// isAggregateFunc 是否为支持的聚合函数
+func isAggregateFunc(name string) bool {
+	switch name {
+	case "count", "sum", "min", "max", "avg":
+		return true
+	}
+	return false
+}
+
+// exprFieldName 获取表达式对应的字段名称
+// 聚合函数转换为 count(*)、sum(spec.replicas) 的形式，与查询字段在结果中的key一致
+// 字段名称按原始内容拼接，避免status等关键字被sqlparser格式化为`status`.phase
+func exprFieldName(expr sqlparser.Expr) string {
+	switch node := expr.(type) {
+	case *sqlparser.FuncExpr:
+		// 函数参数中的字段去掉反引号，常量保持sql写法，如 json_extract(metadata.annotations, '$.a')
+		args := make([]string, 0, len(node.Exprs))
+		for _, e := range node.Exprs {
+			aliased, ok := e.(*sqlparser.AliasedExpr)
+			if !ok {
+				args = append(args, sqlparser.String(e))
+				continue
+			}
+			switch arg := aliased.Expr.(type) {
+			case *sqlparser.SQLVal, *sqlparser.NullVal, sqlparser.BoolVal, *sqlparser.UnaryExpr:
+				args = append(args, sqlparser.String(arg))
+			default:
+				args = append(args, exprFieldName(arg))
+			}
+		}
+		return fmt.Sprintf("%s(%s)", node.Name.Lowered(), strings.Join(args, ", "))
+	case *sqlparser.ColName:
+		var parts []string
+		for _, part := range []string{node.Qualifier.Qualifier.String(), node.Qualifier.Name.String(), node.Name.String()} {
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+		return strings.Join(parts, ".")
 	}
-	return conditions
+	return utils.TrimQuotes(sqlparser.String(expr))
+}
+
+// parseGroupBy 解析分组字段
+func parseGroupBy(groupBy sqlparser.GroupBy) []string {
+	var fields []string
+	for _, expr := range groupBy {
+		fields = append(fields, exprFieldName(expr))
+	}
+	return fields
+}
+
+// splitOrderBy 从sql中拆分出最外层的order by子句
+// sqlparser不支持 nulls first、nulls last 语法，因此order by 子句从sql中移除，由kom自行解析
+// 返回移除order by后的sql，以及order by子句内容（不含order by关键字）
+func splitOrderBy(sql string) (string, string) {
+	start, clauseStart := indexTopLevelKeyword(sql, "order by", 0)
+	if start == -1 {
+		return sql, ""
+	}
+	end, _ := indexTopLevelKeyword(sql, "limit", clauseStart)
+	if end == -1 {
+		end = len(sql)
+	}
+	return sql[:start] + " " + sql[end:], strings.TrimSpace(sql[clauseStart:end])
+}
+
+// ParseOrderBy 解析排序子句
+// order by `metadata.namespace` asc, metadata.creationTimestamp desc nulls last
+// 未指定nulls first、nulls last时，字段不存在视为最大值，即升序时排在最后，降序时排在最前
+func ParseOrderBy(order string) []OrderField {
+	order = strings.TrimSpace(order)
+	if strings.HasPrefix(strings.ToLower(order), "order by") {
+		order = order[len("order by"):]
+	}
+	var fields []OrderField
+	for _, ord := range utils.SplitTopLevel(order, ',') {
+		words := strings.Fields(ord)
+		if len(words) == 0 {
+			continue
+		}
+		of := OrderField{}
+		nullsSet := false
+		// 从后向前解析 nulls first/last 以及 asc/desc
+		if n := len(words); n >= 3 && strings.EqualFold(words[n-2], "nulls") {
+			of.NullsFirst = strings.EqualFold(words[n-1], "first")
+			nullsSet = true
+			words = words[:n-2]
+		}
+		if n := len(words); n >= 2 {
+			switch strings.ToLower(words[n-1]) {
+			case "desc":
+				of.Desc = true
+				words = words[:n-1]
+			case "asc":
+				words = words[:n-1]
+			}
+		}
+		if !nullsSet {
+			of.NullsFirst = of.Desc
+		}
+		of.Field = strings.TrimSpace(utils.TrimQuotes(strings.Join(words, " ")))
+		fields = append(fields, of)
+	}
+	return fields
+}
+
+// indexTopLevelKeyword 查找不在引号、括号内的关键字，返回关键字的起止位置，未找到时返回-1
+// 不区分大小写，关键字中的空格可匹配多个空白字符
+func indexTopLevelKeyword(sql string, keyword string, from int) (int, int) {
+	words := strings.Fields(strings.ToLower(keyword))
+	lower := strings.ToLower(sql)
+	var quote byte
+	depth := 0
+	for i := from; i < len(lower); i++ {
+		c := lower[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			continue
+		case c == '(':
+			depth++
+			continue
+		case c == ')':
+			depth--
+			continue
+		}
+		if depth != 0 || (i > 0 && isWordChar(lower[i-1])) {
+			continue
+		}
+		if end := matchWords(lower, i, words); end != -1 {
+			return i, end
+		}
+	}
+	return -1, -1
+}
+
+// matchWords 判断从pos开始是否依次匹配各个单词，单词之间为空白字符，匹配成功返回结束位置
+func matchWords(s string, pos int, words []string) int {
+	for idx, w := range words {
+		if idx > 0 {
+			n := pos
+			for pos < len(s) && (s[pos] == ' ' || s[pos] == '\t' || s[pos] == '\n' || s[pos] == '\r') {
+				pos++
+			}
+			if pos == n {
+				return -1
+			}
+		}
+		if !strings.HasPrefix(s[pos:], w) {
+			return -1
+		}
+		pos += len(w)
+	}
+	if pos < len(s) && isWordChar(s[pos]) {
+		return -1
+	}
+	return pos
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// fromTable 查询的表
+type fromTable struct {
+	Table string
+	Alias string
+}
+
+// parseFrom 解析from子句，返回主表及关联的表
+// 支持 from pod p join node n on p.spec.nodeName = n.metadata.name 形式，on条件为一个或多个使用and连接的等值条件
+func parseFrom(from sqlparser.TableExprs) (fromTable, []Join, error) {
+	if len(from) != 1 {
+		return fromTable{}, nil, fmt.Errorf("multiple tables in from are not supported, please use join: %s", sqlparser.String(from))
+	}
+	return parseTableExpr(from[0])
+}
+
+func parseTableExpr(expr sqlparser.TableExpr) (fromTable, []Join, error) {
+	switch node := expr.(type) {
+	case *sqlparser.AliasedTableExpr:
+		tableName, ok := node.Expr.(sqlparser.TableName)
+		if !ok {
+			return fromTable{}, nil, fmt.Errorf("unsupported table expression: %s", sqlparser.String(node))
+		}
+		table := fromTable{Table: tableName.Name.String(), Alias: node.As.String()}
+		if table.Alias == "" {
+			table.Alias = table.Table
+		}
+		return table, nil, nil
+	case *sqlparser.ParenTableExpr:
+		if len(node.Exprs) != 1 {
+			return fromTable{}, nil, fmt.Errorf("unsupported table expression: %s", sqlparser.String(node))
+		}
+		return parseTableExpr(node.Exprs[0])
+	case *sqlparser.JoinTableExpr:
+		main, joins, err := parseTableExpr(node.LeftExpr)
+		if err != nil {
+			return fromTable{}, nil, err
+		}
+		right, rightJoins, err := parseTableExpr(node.RightExpr)
+		if err != nil {
+			return fromTable{}, nil, err
+		}
+		if len(rightJoins) > 0 {
+			return fromTable{}, nil, fmt.Errorf("nested join on the right side is not supported: %s", sqlparser.String(node))
+		}
+		join := Join{Table: right.Table, Alias: right.Alias}
+		switch node.Join {
+		case sqlparser.JoinStr, sqlparser.StraightJoinStr:
+			join.Type = sqlparser.JoinStr
+		case sqlparser.LeftJoinStr:
+			join.Type = sqlparser.LeftJoinStr
+		default:
+			return fromTable{}, nil, fmt.Errorf("unsupported join type: %s", node.Join)
+		}
+		if node.Condition.On == nil {
+			return fromTable{}, nil, fmt.Errorf("join %s requires an on condition", right.Table)
+		}
+		if err = parseJoinOn(&join, node.Condition.On); err != nil {
+			return fromTable{}, nil, err
+		}
+		return main, append(joins, join), nil
+	default:
+		return fromTable{}, nil, fmt.Errorf("unsupported table expression: %s", sqlparser.String(expr))
+	}
+}
+
+// parseJoinOn 解析join的on条件，区分关联表一侧及已有表一侧的字段
+func parseJoinOn(join *Join, expr sqlparser.Expr) error {
+	switch node := expr.(type) {
+	case *sqlparser.ParenExpr:
+		return parseJoinOn(join, node.Expr)
+	case *sqlparser.AndExpr:
+		if err := parseJoinOn(join, node.Left); err != nil {
+			return err
+		}
+		return parseJoinOn(join, node.Right)
+	case *sqlparser.ComparisonExpr:
+		if node.Operator != sqlparser.EqualStr {
+			return fmt.Errorf("only equality conditions are supported in join on: %s", sqlparser.String(node))
+		}
+		left := exprFieldName(node.Left)
+		right := exprFieldName(node.Right)
+		prefix := join.Alias + "."
+		switch {
+		case strings.HasPrefix(right, prefix) && !strings.HasPrefix(left, prefix):
+			join.LeftFields = append(join.LeftFields, left)
+			join.RightFields = append(join.RightFields, right)
+		case strings.HasPrefix(left, prefix) && !strings.HasPrefix(right, prefix):
+			join.LeftFields = append(join.LeftFields, right)
+			join.RightFields = append(join.RightFields, left)
+		default:
+			return fmt.Errorf("join on condition must compare a field of %s with a field of another table: %s", join.Alias, sqlparser.String(node))
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported join on condition: %s", sqlparser.String(expr))
+	}
+}
+
+// parseUpdateExprs 解析update语句的set子句
+// set spec.replicas=0, metadata.labels.env='prod', metadata.annotations.x=null
+// 值为null时，合并patch会删除该字段
+func parseUpdateExprs(exprs sqlparser.UpdateExprs, args bindArgs) ([]SetField, error) {
+	var sets []SetField
+	for _, e := range exprs {
+		field := exprFieldName(e.Name)
+		value, err := parseSetValue(e.Expr, args)
+		if err != nil {
+			return nil, fmt.Errorf("set %s: %v", field, err)
+		}
+		sets = append(sets, SetField{Field: field, Value: value})
+	}
+	return sets, nil
+}
+
+// parseSetValue 按sql字面量类型获取set的值，字符串保持原样，不做类型推断
+func parseSetValue(expr sqlparser.Expr, args bindArgs) (interface{}, error) {
+	if arg, ok, err := args.lookup(expr); ok || err != nil {
+		// 绑定的参数保持原始的Go类型，序列化为patch时使用
+		return arg, err
+	}
+	switch v := expr.(type) {
+	case *sqlparser.SQLVal:
+		switch v.Type {
+		case sqlparser.StrVal:
+			return string(v.Val), nil
+		case sqlparser.IntVal:
+			return strconv.ParseInt(string(v.Val), 10, 64)
+		case sqlparser.FloatVal:
+			return strconv.ParseFloat(string(v.Val), 64)
+		}
+	case *sqlparser.NullVal:
+		return nil, nil
+	case sqlparser.BoolVal:
+		return bool(v), nil
+	case *sqlparser.UnaryExpr:
+		if v.Operator == sqlparser.UMinusStr {
+			value, err := parseSetValue(v.Expr, args)
+			if err != nil {
+				return nil, err
+			}
+			switch n := value.(type) {
+			case int64:
+				return -n, nil
+			case float64:
+				return -n, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unsupported value %s", sqlparser.String(expr))
+}
+
+// quoteFieldPaths 为sqlparser无法解析的字段路径添加反引号，作为一个完整的字段名称解析
+// 包含[]的路径，如 metadata.labels['app.kubernetes.io/name']、spec.containers[0].image、status.addresses[type=InternalIP].address
+// 超过三级的路径，如 spec.template.spec.nodeName
+// 引号、反引号内的内容保持不变
+func quoteFieldPaths(sql string) string {
+	var sb strings.Builder
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := indexQuoteEnd(sql, i)
+			sb.WriteString(sql[i:end])
+			i = end
+		case isIdentStart(c) && (i == 0 || !isWordChar(sql[i-1])):
+			end, quote := scanFieldPath(sql, i)
+			if quote {
+				sb.WriteString("`" + sql[i:end] + "`")
+			} else {
+				sb.WriteString(sql[i:end])
+			}
+			i = end
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// indexQuoteEnd 返回start位置的引号对应的结束位置之后的下标
+func indexQuoteEnd(sql string, start int) int {
+	quote := sql[start]
+	for i := start + 1; i < len(sql); i++ {
+		if sql[i] == '\\' && quote != '`' {
+			i++
+			continue
+		}
+		if sql[i] == quote {
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// scanFieldPath 从start位置扫描字段路径，返回结束位置及是否需要添加反引号
+func scanFieldPath(sql string, start int) (int, bool) {
+	dots := 0
+	bracket := false
+	i := start
+	for i < len(sql) {
+		c := sql[i]
+		switch {
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9'):
+			i++
+		case c == '.' && i+1 < len(sql) && (isIdentStart(sql[i+1]) || sql[i+1] == '['):
+			dots++
+			i++
+		case c == '[':
+			end := indexPathBracketEnd(sql, i)
+			if end < 0 {
+				return i, false
+			}
+			bracket = true
+			i = end + 1
+		default:
+			return i, bracket || dots >= 3
+		}
+	}
+	return i, bracket || dots >= 3
+}
+
+// indexPathBracketEnd 查找与start位置的[匹配的]，忽略引号内的内容
+func indexPathBracketEnd(sql string, start int) int {
+	for i := start + 1; i < len(sql); i++ {
+		switch sql[i] {
+		case '\'', '"':
+			i = indexQuoteEnd(sql, i) - 1
+		case ']':
+			return i
+		case '`':
+			return -1
+		}
+	}
+	return -1
+}
+
+// isIdentStart 是否为字段名称的起始字符
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
 }
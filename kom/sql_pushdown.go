@@ -0,0 +1,337 @@
+package kom
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/weibaohui/kom/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// selectorValue 字段合法值的大小写规则
+// api server 按大小写敏感比较selector，本地 =、in 不区分大小写，只有转换后结果一致时才能下推
+type selectorValue struct {
+	lower bool     // 合法值只含小写字母，如DNS名称，值转为小写后下推
+	enum  []string // 合法值为固定的枚举值，按不区分大小写匹配到枚举值后下推
+}
+
+var (
+	// anyCase 合法值大小写不限，只有值中不含字母时才能下推
+	anyCase = selectorValue{}
+	// lowerCase 合法值为小写的DNS名称
+	lowerCase = selectorValue{lower: true}
+)
+
+// fieldSelectorFields 除metadata.name外，各资源额外支持的field selector字段
+// 只列出字符串类型的字段，以Kind为key，仅限core组
+var fieldSelectorFields = map[string]map[string]selectorValue{
+	"Pod": {
+		"spec.nodeName":            lowerCase,
+		"spec.restartPolicy":       {enum: []string{"Always", "OnFailure", "Never"}},
+		"spec.schedulerName":       anyCase,
+		"spec.serviceAccountName":  lowerCase,
+		"status.phase":             {enum: []string{"Pending", "Running", "Succeeded", "Failed", "Unknown"}},
+		"status.podIP":             anyCase,
+		"status.nominatedNodeName": lowerCase,
+	},
+	"Event": {
+		"involvedObject.kind":       anyCase,
+		"involvedObject.namespace":  lowerCase,
+		"involvedObject.name":       anyCase,
+		"involvedObject.uid":        lowerCase,
+		"involvedObject.apiVersion": anyCase,
+		"involvedObject.fieldPath":  anyCase,
+		"reason":                    anyCase,
+		"reportingComponent":        anyCase,
+		"type":                      {enum: []string{"Normal", "Warning"}},
+	},
+	"Secret":    {"type": anyCase},
+	"Namespace": {"status.phase": {enum: []string{"Active", "Terminating"}}},
+}
+
+// normalize 将本地不区分大小写比较的值转换为api server中唯一可能相等的值，无法转换时不能下推
+func (v selectorValue) normalize(value string) (string, bool) {
+	switch {
+	case v.lower:
+		return strings.ToLower(value), true
+	case len(v.enum) > 0:
+		for _, e := range v.enum {
+			if strings.EqualFold(e, value) {
+				return e, true
+			}
+		}
+		// 不是合法的枚举值，api server 与本地都不会匹配
+		return value, true
+	default:
+		return value, caseless(value)
+	}
+}
+
+// caseless 值中不含区分大小写的字母，按是否区分大小写比较的结果一致
+func caseless(value string) bool {
+	return strings.ToLower(value) == strings.ToUpper(value)
+}
+
+// PushDown where 条件下推到api server的结果
+// 只下推顶层AND连接的条件，且只下推字符串值的 =、in 条件，其余条件作为Residual在本地过滤
+// 本地 =、in 不区分大小写，api server 区分大小写，下推的selector与本地比较的结果一致，或是本地结果的超集：
+// 合法值为小写或枚举值的字段转换为规范值后下推；label值含字母时下推 key 存在的条件，原条件仍在本地过滤
+type PushDown struct {
+	LabelSelector string         `json:"labelSelector,omitempty"` // 下推的label selector
+	FieldSelector string         `json:"fieldSelector,omitempty"` // 下推的field selector
+	Namespaces    []string       `json:"namespaces,omitempty"`    // 下推的命名空间，逐个命名空间查询
+	Pushed        []Condition    `json:"pushed,omitempty"`        // 已下推的条件
+	Residual      *ConditionExpr `json:"residual,omitempty"`      // 需在本地过滤的条件
+}
+
+// ApplyTo 将下推的selector合并到ListOptions中
+func (p PushDown) ApplyTo(opt metav1.ListOptions) metav1.ListOptions {
+	opt.LabelSelector = mergeSelectors(opt.LabelSelector, p.LabelSelector)
+	opt.FieldSelector = mergeSelectors(opt.FieldSelector, p.FieldSelector)
+	return opt
+}
+
+// ListCacheKey 列表查询的缓存key，包含实际查询的命名空间、selector及分页参数，条件不同的查询不共用缓存
+func (s *Statement) ListCacheKey(p PushDown, opt metav1.ListOptions) string {
+	resource := s.GVR.Resource
+	if s.Filter.Virtual != nil {
+		// 虚拟表缓存展开后的行，与父资源分开缓存
+		resource += "." + s.Filter.Virtual.Name
+	}
+	return fmt.Sprintf("list/%s/%s/%s/%s/%s/%s/%d/%s/%s", s.GVR.Group, s.GVR.Version, resource,
+		strings.Join(s.ListNamespaces(p), ","), opt.LabelSelector, opt.FieldSelector, opt.Limit, opt.Continue, opt.ResourceVersion)
+}
+
+// ListNamespaces 列表需要查询的命名空间，集群级资源及全部命名空间为空字符串
+func (s *Statement) ListNamespaces(p PushDown) []string {
+	if !s.Namespaced {
+		return []string{metav1.NamespaceAll}
+	}
+	if len(p.Namespaces) > 0 {
+		// where 条件限定了命名空间，逐个命名空间查询
+		return p.Namespaces
+	}
+	if s.AllNamespace || len(s.NamespaceList) > 1 {
+		// 全部命名空间 或者  传入多个命名空间时，client-go 不支持跨命名空间查询，就全部查出来，后面再过滤
+		return []string{metav1.NamespaceAll}
+	}
+	ns := s.Namespace
+	if ns == "" {
+		ns = metav1.NamespaceDefault
+	}
+	return []string{ns}
+}
+
+// PushDownWhere 分析where条件，将api server可以执行的条件转换为label selector、field selector及命名空间
+// metadata.labels.app='x' 转换为 label selector app=x
+// metadata.labels.app in ('x','y') 转换为 label selector app in (x,y)
+// metadata.name='x'、spec.nodeName='x'、status.phase='x' 等转换为 field selector
+// metadata.namespace='x'、metadata.namespace in ('x','y') 转换为按命名空间查询
+// expr 一般为 Filter.WhereExpr 执行子查询后的表达式，参见 ResolveSubqueries
+func (s *Statement) PushDownWhere(expr *ConditionExpr) PushDown {
+	plan := PushDown{Residual: expr}
+	if expr == nil || len(s.Filter.Joins) > 0 {
+		// 关联查询的字段带有表别名，不下推
+		return plan
+	}
+	// 虚拟表只有metadata来自父资源，其他字段为展开后的元素字段，不能下推
+	virtual := s.Filter.Virtual != nil
+
+	var conjuncts []*ConditionExpr
+	if expr.Logic == "AND" {
+		conjuncts = expr.Children
+	} else {
+		conjuncts = []*ConditionExpr{expr}
+	}
+
+	// 只有查询范围为全部命名空间时，才能将命名空间条件转换为按命名空间查询
+	nsScope := s.Namespaced && (s.AllNamespace || len(s.NamespaceList) > 1)
+
+	var labels, fieldSelectors []string
+	var residual []*ConditionExpr
+	for _, c := range conjuncts {
+		if nsScope && plan.Namespaces == nil {
+			if namespaces, ok := namespaceValues(c); ok {
+				plan.Namespaces = namespaces
+				plan.Pushed = append(plan.Pushed, c.Flatten()...)
+				continue
+			}
+		}
+		if c.Condition != nil {
+			if selector, exact, ok := labelSelector(c.Condition); ok {
+				labels = append(labels, selector)
+				if exact {
+					plan.Pushed = append(plan.Pushed, *c.Condition)
+					continue
+				}
+				// 只下推了 key 存在的条件，值在本地不区分大小写比较
+				residual = append(residual, c)
+				continue
+			}
+			if selector, ok := s.fieldSelector(c.Condition); ok && (!virtual || strings.HasPrefix(c.Condition.Field, "metadata.")) {
+				fieldSelectors = append(fieldSelectors, selector)
+				plan.Pushed = append(plan.Pushed, *c.Condition)
+				continue
+			}
+		}
+		residual = append(residual, c)
+	}
+
+	plan.LabelSelector = strings.Join(labels, ",")
+	plan.FieldSelector = strings.Join(fieldSelectors, ",")
+	switch len(residual) {
+	case 0:
+		plan.Residual = nil
+	case 1:
+		plan.Residual = residual[0]
+	default:
+		plan.Residual = &ConditionExpr{Logic: "AND", Children: residual}
+	}
+	return plan
+}
+
+// namespaceValues 获取命名空间条件中的命名空间
+// 支持 metadata.namespace='x'、metadata.namespace in ('x','y')，以及多个命名空间条件的OR，如Namespace("a","b")生成的条件
+func namespaceValues(expr *ConditionExpr) ([]string, bool) {
+	var exprs []*ConditionExpr
+	switch {
+	case expr.Condition != nil:
+		exprs = []*ConditionExpr{expr}
+	case expr.Logic == "OR":
+		exprs = expr.Children
+	default:
+		return nil, false
+	}
+	namespaces := sets.New[string]()
+	for _, e := range exprs {
+		if e.Condition == nil || e.Condition.Field != "metadata.namespace" {
+			return nil, false
+		}
+		values, ok := stringValues(e.Condition)
+		if !ok {
+			return nil, false
+		}
+		for _, v := range values {
+			// 命名空间名称只能为小写，转为小写后与本地不区分大小写比较的结果一致
+			v = strings.ToLower(v)
+			if len(validation.IsDNS1123Label(v)) > 0 {
+				return nil, false
+			}
+			namespaces.Insert(v)
+		}
+	}
+	return sets.List(namespaces), true
+}
+
+// labelSelector 将 metadata.labels.xxx 的条件转换为label selector
+// label值大小写不限，值中含字母时只下推 key 存在的条件，exact 为false，原条件需在本地过滤
+func labelSelector(cond *Condition) (selector string, exact bool, ok bool) {
+	key, ok := labelKey(cond.Field)
+	if !ok || len(validation.IsQualifiedName(key)) > 0 {
+		return "", false, false
+	}
+	values, ok := stringValues(cond)
+	if !ok {
+		return "", false, false
+	}
+	exact = true
+	for _, v := range values {
+		if len(validation.IsValidLabelValue(v)) > 0 {
+			return "", false, false
+		}
+		if !caseless(v) {
+			exact = false
+		}
+	}
+	if !exact {
+		// 空值的label也存在key，key 存在的条件是本地匹配结果的超集
+		return key, false, true
+	}
+	if cond.Operator == "=" {
+		return fmt.Sprintf("%s=%s", key, values[0]), true, true
+	}
+	sort.Strings(values)
+	return fmt.Sprintf("%s in (%s)", key, strings.Join(values, ",")), true, true
+}
+
+// labelKey 获取label字段的key，支持 metadata.labels.app 及 metadata.labels['app.kubernetes.io/name'] 两种写法
+func labelKey(field string) (string, bool) {
+	if key, ok := strings.CutPrefix(field, "metadata.labels."); ok {
+		return key, !strings.ContainsAny(key, ".[")
+	}
+	key, ok := strings.CutPrefix(field, "metadata.labels[")
+	if !ok || !strings.HasSuffix(key, "]") {
+		return "", false
+	}
+	key = key[:len(key)-1]
+	if len(key) < 2 || (key[0] != '\'' && key[0] != '"') || key[len(key)-1] != key[0] {
+		return "", false
+	}
+	return key[1 : len(key)-1], true
+}
+
+// fieldSelector 将资源支持的字段条件转换为field selector，field selector 不支持in
+// 值按字段的大小写规则转换，无法保证与本地比较结果一致时不下推
+func (s *Statement) fieldSelector(cond *Condition) (string, bool) {
+	if cond.Operator != "=" {
+		return "", false
+	}
+	rule, ok := s.fieldSelectorValue(cond.Field)
+	if !ok {
+		return "", false
+	}
+	values, ok := stringValues(cond)
+	if !ok {
+		return "", false
+	}
+	value, ok := rule.normalize(values[0])
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s=%s", cond.Field, fields.EscapeValue(value)), true
+}
+
+// fieldSelectorValue 判断字段是否支持field selector，并返回字段值的大小写规则
+// core组资源的名称均为小写的DNS名称，其他组的资源名称（如RBAC）可以包含大写字母
+func (s *Statement) fieldSelectorValue(field string) (selectorValue, bool) {
+	if s.GVK.Group != "" {
+		return anyCase, field == "metadata.name"
+	}
+	if field == "metadata.name" {
+		return lowerCase, true
+	}
+	rule, ok := fieldSelectorFields[s.GVK.Kind][field]
+	return rule, ok
+}
+
+// stringValues 获取 =、in 条件中的字符串值，其他操作符或非字符串值不能下推
+// 数字、时间等值在本地比较时会按类型比较，与api server的字符串比较结果不一致
+func stringValues(cond *Condition) ([]string, bool) {
+	switch cond.Operator {
+	case "=":
+		str, ok := cond.Value.(string)
+		if !ok || cond.ValueType != utils.TypeString {
+			return nil, false
+		}
+		return []string{str}, true
+	case "in":
+		list, ok := cond.Value.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, false
+		}
+		var values []string
+		for _, v := range list {
+			str, ok := v.(string)
+			if !ok {
+				return nil, false
+			}
+			values = append(values, str)
+		}
+		return values, true
+	}
+	return nil, false
+}
@@ -0,0 +1,130 @@
+package kom
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Subquery in、not in 中的子查询
+// select * from pod where spec.nodeName in (select metadata.name from node where metadata.labels.pool='gpu')
+// 子查询只能查询一个字段，在同一集群中按Sql()的解析逻辑独立执行，不支持引用外层查询的字段
+type Subquery struct {
+	Sql string `json:"sql,omitempty"` // 子查询sql
+
+	stmt *sqlparser.Select
+	args bindArgs // 外层sql绑定的参数，子查询中的占位符按外层的序号取值
+}
+
+// newSubquery 创建子查询
+func newSubquery(sub *sqlparser.Subquery, args bindArgs) (*Subquery, error) {
+	selectStmt, ok := sub.Select.(*sqlparser.Select)
+	if !ok {
+		return nil, fmt.Errorf("unsupported subquery: %s", sqlparser.String(sub))
+	}
+	columns, err := parseSelectExprs(selectStmt.SelectExprs)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) != 1 || columns[0].Func != "" || len(selectStmt.GroupBy) > 0 {
+		return nil, fmt.Errorf("subquery must select exactly one field: %s", sqlparser.String(sub))
+	}
+	return &Subquery{
+		Sql:  sqlparser.String(selectStmt),
+		stmt: selectStmt,
+		args: args,
+	}, nil
+}
+
+// ResolveSubqueries 执行条件中的子查询，返回将子查询替换为值列表后的条件表达式
+// 不修改原有的表达式，没有子查询时直接返回原表达式
+func (s *Statement) ResolveSubqueries(expr *ConditionExpr) (*ConditionExpr, error) {
+	if expr == nil {
+		return nil, nil
+	}
+	if expr.Condition != nil {
+		if expr.Condition.Subquery == nil {
+			return expr, nil
+		}
+		values, err := s.executeSubquery(expr.Condition.Subquery)
+		if err != nil {
+			return nil, err
+		}
+		cond := *expr.Condition
+		cond.Value = values
+		cond.Subquery = nil
+		return &ConditionExpr{Condition: &cond}, nil
+	}
+
+	resolved := &ConditionExpr{Logic: expr.Logic}
+	changed := false
+	for _, child := range expr.Children {
+		c, err := s.ResolveSubqueries(child)
+		if err != nil {
+			return nil, err
+		}
+		changed = changed || c != child
+		resolved.Children = append(resolved.Children, c)
+	}
+	if !changed {
+		return expr, nil
+	}
+	return resolved, nil
+}
+
+// executeSubquery 在同一集群中执行子查询，返回查询字段的全部值，数组字段展开为多个值
+func (s *Statement) executeSubquery(sub *Subquery) ([]interface{}, error) {
+	tx, err := s.subqueryInstance(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]interface{}
+	if err := tx.List(&rows).Error; err != nil {
+		return nil, fmt.Errorf("subquery %s: %v", sub.Sql, err)
+	}
+
+	name := tx.Statement.Filter.Projections[0].Name()
+	values := make([]interface{}, 0, len(rows))
+	for _, row := range rows {
+		values = appendSubqueryValue(values, row[name])
+	}
+	return values, nil
+}
+
+// subqueryInstance 创建执行子查询的实例，沿用外层查询的集群、上下文及缓存时间
+func (s *Statement) subqueryInstance(sub *Subquery) (*Kubectl, error) {
+	tx := Cluster(s.ID).WithContext(s.Context).AllNamespace().WithCache(s.CacheTTL)
+	if err := tx.parseSelectStmt(sub.stmt, sub.args); err != nil {
+		return nil, fmt.Errorf("subquery %s: %v", sub.Sql, err)
+	}
+	if len(sub.stmt.OrderBy) > 0 {
+		tx.Statement.Filter.Order = sqlparser.String(sub.stmt.OrderBy)
+	}
+	tx.Statement.Filter.Parsed = true
+	return tx, nil
+}
+
+// appendSubqueryValue 将子查询的值加入值列表，数字转换为float64，与in列表中的数字一致
+func appendSubqueryValue(values []interface{}, value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return values
+	case []interface{}:
+		for _, item := range v {
+			values = appendSubqueryValue(values, item)
+		}
+		return values
+	case string, bool, float64:
+		return append(values, v)
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return append(values, float64(rv.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return append(values, float64(rv.Uint()))
+	}
+	return append(values, fmt.Sprintf("%v", value))
+}
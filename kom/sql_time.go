@@ -0,0 +1,137 @@
+package kom
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weibaohui/kom/utils"
+	"github.com/xwb1989/sqlparser"
+)
+
+// timeExprValue 解析相对时间表达式，返回在比较时才计算具体时间的 utils.RelativeTime
+// 支持 now()、current_timestamp()，以及加减 interval 或时长，可以连续加减：
+// now() - interval 7 day
+// now() - '36h'、now() - '1d12h'
+// now() - ? 绑定 time.Duration 或时长字符串
+func timeExprValue(expr sqlparser.Expr, args bindArgs) (utils.RelativeTime, bool, error) {
+	switch node := expr.(type) {
+	case *sqlparser.FuncExpr:
+		name := node.Name.Lowered()
+		if (name == "now" || name == "current_timestamp") && len(node.Exprs) == 0 {
+			return utils.RelativeTime{}, true, nil
+		}
+	case *sqlparser.ParenExpr:
+		return timeExprValue(node.Expr, args)
+	case *sqlparser.BinaryExpr:
+		if node.Operator != sqlparser.PlusStr && node.Operator != sqlparser.MinusStr {
+			return utils.RelativeTime{}, false, nil
+		}
+		t, ok, err := timeExprValue(node.Left, args)
+		if !ok || err != nil {
+			return t, ok, err
+		}
+		d, months, err := durationValue(node.Right, args)
+		if err != nil {
+			return t, true, err
+		}
+		if node.Operator == sqlparser.MinusStr {
+			d, months = -d, -months
+		}
+		t.Duration += d
+		t.Months += months
+		return t, true, nil
+	}
+	return utils.RelativeTime{}, false, nil
+}
+
+// durationValue 获取时长，支持 interval 7 day、'36h' 等时长字符串，以及绑定的 time.Duration
+// interval month、year 返回月份数
+func durationValue(expr sqlparser.Expr, args bindArgs) (time.Duration, int, error) {
+	if interval, ok := expr.(*sqlparser.IntervalExpr); ok {
+		n, err := intervalNumber(interval.Expr, args)
+		if err != nil {
+			return 0, 0, err
+		}
+		return utils.IntervalDuration(n, interval.Unit)
+	}
+	arg, ok, err := args.lookup(expr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if ok {
+		switch v := arg.(type) {
+		case time.Duration:
+			return v, 0, nil
+		case string:
+			d, err := utils.ParseDuration(v)
+			return d, 0, err
+		}
+		return 0, 0, fmt.Errorf("unsupported duration value %v(%T)", arg, arg)
+	}
+	if v, ok := expr.(*sqlparser.SQLVal); ok && v.Type == sqlparser.StrVal {
+		d, err := utils.ParseDuration(string(v.Val))
+		return d, 0, err
+	}
+	return 0, 0, fmt.Errorf("unsupported duration: %s", sqlparser.String(expr))
+}
+
+// intervalNumber 获取 interval 的数量，如 interval 7 day 中的 7，可以绑定参数
+func intervalNumber(expr sqlparser.Expr, args bindArgs) (float64, error) {
+	value := literalValue(expr)
+	if arg, ok, err := args.lookup(expr); ok || err != nil {
+		if err != nil {
+			return 0, err
+		}
+		value = fmt.Sprintf("%v", arg)
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval value %s", value)
+	}
+	return n, nil
+}
+
+// intervalSeconds 单独使用的 interval 作为秒数，用于与age()比较，如 age(metadata.creationTimestamp) > interval 7 day
+func intervalSeconds(interval *sqlparser.IntervalExpr, args bindArgs) (float64, error) {
+	d, months, err := durationValue(interval, args)
+	if err != nil {
+		return 0, err
+	}
+	if months != 0 {
+		return 0, fmt.Errorf("interval %s has no fixed length, use day or week instead", interval.Unit)
+	}
+	return d.Seconds(), nil
+}
+
+// isAgeField 是否为 age(field) 字段，age 的值为字段时间距今的秒数
+func isAgeField(field string) bool {
+	return strings.HasPrefix(field, "age(") && strings.HasSuffix(field, ")")
+}
+
+// ageConditionValue age(field) 与时长字符串比较时，将时长转换为秒数
+// age(metadata.creationTimestamp) > '7d'、age(status.startTime) between '1h' and '1d'
+func ageConditionValue(cond *Condition) {
+	if !isAgeField(cond.Field) {
+		return
+	}
+	seconds := func(v interface{}) interface{} {
+		if s, ok := v.(string); ok {
+			if d, err := utils.ParseDuration(s); err == nil {
+				return d.Seconds()
+			}
+		}
+		return v
+	}
+	if values, ok := cond.Value.([]interface{}); ok {
+		for i, v := range values {
+			values[i] = seconds(v)
+		}
+		return
+	}
+	if v := seconds(cond.Value); v != cond.Value {
+		cond.ValueType = utils.TypeNumber
+		cond.Value = v
+	}
+}
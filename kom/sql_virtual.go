@@ -0,0 +1,98 @@
+package kom
+
+import (
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// VirtualTable 虚拟表，将父资源中的数组字段展开为行，只支持查询
+// 每个数组元素为一行，元素的字段位于行的顶层，父资源的metadata作为行的metadata，index 为元素在数组中的位置
+// 按 metadata.namespace、metadata.name、metadata.labels 的条件仍可下推到api server查询父资源
+//
+//	select metadata.namespace, metadata.name, name, image from container where image like '%nginx%'
+//	select metadata.name, name from container where resources.limits.memory is null
+//	select metadata.name from condition where type='Ready' and status='False' and lastTransitionTime < now() - '10m'
+type VirtualTable struct {
+	Name   string `json:"name,omitempty"`   // 表名，如 container
+	Parent string `json:"parent,omitempty"` // 父资源的表名，如 pod
+	Path   string `json:"path,omitempty"`   // 展开的数组字段路径，如 spec.containers
+}
+
+// VirtualIndexColumn 虚拟表中元素在父资源数组中的位置
+const VirtualIndexColumn = "index"
+
+var (
+	virtualTables     = make(map[string]*VirtualTable)
+	virtualTablesLock sync.RWMutex
+)
+
+func init() {
+	RegisterVirtualTable("container", "pod", "spec.containers")
+	RegisterVirtualTable("initcontainer", "pod", "spec.initContainers")
+	RegisterVirtualTable("ephemeralcontainer", "pod", "spec.ephemeralContainers")
+	RegisterVirtualTable("container_status", "pod", "status.containerStatuses")
+	RegisterVirtualTable("pod_volume", "pod", "spec.volumes")
+	RegisterVirtualTable("condition", "pod", "status.conditions")
+	RegisterVirtualTable("node_condition", "node", "status.conditions")
+	RegisterVirtualTable("deployment_condition", "deployment", "status.conditions")
+}
+
+// RegisterVirtualTable 注册虚拟表，表名不区分大小写，同名虚拟表会覆盖已注册的虚拟表
+// parent 为父资源的表名，可以是kind、复数名称或简称，path 为父资源中数组字段的路径
+//
+//	kom.RegisterVirtualTable("service_port", "service", "spec.ports")
+//	err := kom.DefaultCluster().Sql("select metadata.name, port from service_port where nodePort > 0").List(&rows).Error
+func RegisterVirtualTable(name, parent, path string) {
+	virtualTablesLock.Lock()
+	defer virtualTablesLock.Unlock()
+	virtualTables[strings.ToLower(name)] = &VirtualTable{Name: strings.ToLower(name), Parent: parent, Path: path}
+}
+
+// GetVirtualTable 获取已注册的虚拟表
+func GetVirtualTable(name string) (*VirtualTable, bool) {
+	virtualTablesLock.RLock()
+	defer virtualTablesLock.RUnlock()
+	v, ok := virtualTables[strings.ToLower(name)]
+	return v, ok
+}
+
+// virtualTableNames 已注册的虚拟表名
+func virtualTableNames() []string {
+	virtualTablesLock.RLock()
+	defer virtualTablesLock.RUnlock()
+	names := make([]string, 0, len(virtualTables))
+	for name := range virtualTables {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Unnest 将父资源的数组字段展开为虚拟表的行，行中的值是复制的，不与父资源共享
+func (v *VirtualTable) Unnest(items []unstructured.Unstructured) []unstructured.Unstructured {
+	path := strings.Split(v.Path, ".")
+	rows := make([]unstructured.Unstructured, 0, len(items))
+	for _, item := range items {
+		values, found, err := unstructured.NestedSlice(item.Object, path...)
+		if err != nil || !found || len(values) == 0 {
+			continue
+		}
+		metadata, _, _ := unstructured.NestedMap(item.Object, "metadata")
+		delete(metadata, "managedFields")
+		for i, value := range values {
+			elem, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			row := make(map[string]interface{}, len(elem)+2)
+			for k, val := range elem {
+				row[k] = val
+			}
+			row["metadata"] = metadata
+			row[VirtualIndexColumn] = int64(i)
+			rows = append(rows, unstructured.Unstructured{Object: row})
+		}
+	}
+	return rows
+}
@@ -2,12 +2,16 @@ package kom
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -43,24 +47,220 @@ type Statement struct {
 	StderrCallback      func(data []byte) error     `json:"-"`
 	CacheTTL            time.Duration               `json:"cacheTTL,omitempty"`    // 设置缓存时间
 	ForceDelete         bool                        `json:"forceDelete,omitempty"` // 强制删除标志
+	Items               []unstructured.Unstructured `json:"-"`                     // 已完成查询及过滤的对象，不为nil时List直接使用，多集群查询合并各集群结果时使用
+	PageSize            int64                       `json:"pageSize,omitempty"`    // 列表查询每页获取的对象数量，为0时使用DefaultPageSize
+	Each                ListEachFunc                `json:"-"`                     // ListEach 的回调函数，不为nil时List逐个回调对象，不填充Dest
+	FieldManager        string                      `json:"manager,omitempty"`     // Patch时的field manager，服务端应用时必须设置
+	ForceApply          bool                        `json:"forceApply,omitempty"`  // 服务端应用时强制接管与其他field manager冲突的字段
+	DryRun              bool                        `json:"dryRun,omitempty"`      // 服务端试运行，创建、更新、Patch、删除只经过准入及校验，不持久化
+	ReadLatest          bool                        `json:"readLatest,omitempty"`  // Get 不使用informer，从api server读取最新的对象
 }
+
+// DryRunOptions 写操作的 DryRun 参数，未开启试运行时为nil
+func (s *Statement) DryRunOptions() []string {
+	if s.DryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
+// DefaultPageSize 列表查询默认每页获取的对象数量，与kubectl的默认chunk-size一致
+const DefaultPageSize int64 = 500
+
+// ListEachFunc ListEach 的回调函数
+type ListEachFunc func(obj *unstructured.Unstructured) error
+
 type Filter struct {
-	Columns    []string    `json:"columns,omitempty"`
-	Conditions []Condition `json:"condition,omitempty"` // xx=?
-	Order      string      `json:"order,omitempty"`
-	Limit      int         `json:"limit,omitempty"`
-	Offset     int         `json:"offset,omitempty"`
-	Sql        string      `json:"sql,omitempty"`    // 原始sql
-	Parsed     bool        `json:"parsed,omitempty"` // 是否解析过
-	From       string      `json:"from,omitempty"`   // From TableName
+	Columns     []string       `json:"columns,omitempty"`     // 查询字段在结果中的key，与Projections一一对应
+	Projections []Column       `json:"projections,omitempty"` // 查询字段，为空表示select *，返回完整对象
+	Conditions  []Condition    `json:"condition,omitempty"`   // xx=?，由WhereExpr展开得到的条件列表
+	WhereExpr   *ConditionExpr `json:"whereExpr,omitempty"`   // where 条件表达式树，过滤时按此树求值
+	GroupBy     []string       `json:"groupBy,omitempty"`     // 分组字段
+	Having      *ConditionExpr `json:"having,omitempty"`      // 分组后的过滤条件
+	Order       string         `json:"order,omitempty"`
+	Limit       int            `json:"limit,omitempty"`
+	Offset      int            `json:"offset,omitempty"`
+	Sql         string         `json:"sql,omitempty"`     // 原始sql
+	Parsed      bool           `json:"parsed,omitempty"`  // 是否解析过
+	From        string         `json:"from,omitempty"`    // From TableName
+	Alias       string         `json:"alias,omitempty"`   // From TableName 的别名，关联查询时作为主表对象在结果行中的key
+	Joins       []Join         `json:"joins,omitempty"`   // 关联查询的表
+	Action      string         `json:"action,omitempty"`  // sql语句类型，为空表示select，update、delete 需调用Exec执行
+	Sets        []SetField     `json:"sets,omitempty"`    // update 语句 set 的字段
+	Preview     bool           `json:"preview,omitempty"` // 预览update、delete匹配的对象，不执行修改
+	Explain     bool           `json:"explain,omitempty"` // explain 语句，List时返回执行计划，不查询资源
+	Cluster     bool           `json:"cluster,omitempty"` // 多集群查询，对象上增加虚拟字段cluster，值为集群ID
+	Virtual     *VirtualTable  `json:"virtual,omitempty"` // From 为虚拟表时，查询父资源后展开为行
+}
+
+const (
+	SqlActionUpdate = "update"
+	SqlActionDelete = "delete"
+)
+
+// SetField update 语句中 set 的字段，如 spec.replicas=0
+type SetField struct {
+	Field string      `json:"field,omitempty"` // 字段路径，如 spec.replicas
+	Value interface{} `json:"value,omitempty"` // 字段值，null 为nil，patch时删除该字段
+}
+
+// ExecResult update、delete 语句对单个对象的执行结果
+type ExecResult struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Error     error  `json:"-"` // 执行失败的原因，预览及执行成功时为nil
+}
+
+// Join 关联查询的表，使用 on 条件中的等值字段在内存中进行hash关联
+// 关联查询的结果行以表别名为key，如 {"p": pod对象, "n": node对象}，字段路径需带上别名，如 p.metadata.name
+type Join struct {
+	Table       string                  `json:"table,omitempty"`       // 表名
+	Alias       string                  `json:"alias,omitempty"`       // 别名，未设置时使用表名
+	GVK         schema.GroupVersionKind `json:"GVK"`                   // 表对应的资源类型
+	Type        string                  `json:"type,omitempty"`        // join 或 left join
+	LeftFields  []string                `json:"leftFields,omitempty"`  // on 条件中已有表一侧的字段，如 p.spec.nodeName
+	RightFields []string                `json:"rightFields,omitempty"` // on 条件中关联表一侧的字段，与LeftFields一一对应，如 n.metadata.name
 }
+
+// OrderField 排序字段
+type OrderField struct {
+	Field      string `json:"field,omitempty"`
+	Desc       bool   `json:"desc,omitempty"`
+	NullsFirst bool   `json:"nullsFirst,omitempty"` // 字段不存在的对象是否排在最前
+}
+
+// Column 查询字段
+type Column struct {
+	Field string `json:"field,omitempty"` // 字段路径，如 metadata.name、spec.containers.image，count(*)时为*
+	Alias string `json:"alias,omitempty"` // 别名，为空时使用字段路径作为结果中的key
+	Func  string `json:"func,omitempty"`  // 聚合函数 count、sum、min、max、avg，为空表示普通字段
+}
+
+// Name 返回字段在结果中的key
+// 聚合字段未设置别名时，使用 count(*)、sum(spec.replicas) 形式作为key，在having、order by中可直接引用
+func (c Column) Name() string {
+	if c.Alias != "" {
+		return c.Alias
+	}
+	if c.Func != "" {
+		return fmt.Sprintf("%s(%s)", c.Func, c.Field)
+	}
+	return c.Field
+}
+
+// setProjections 设置查询字段，同时填充Columns
+func (f *Filter) setProjections(columns []Column) {
+	f.Projections = columns
+	f.Columns = nil
+	for _, c := range columns {
+		f.Columns = append(f.Columns, c.Name())
+	}
+}
+
+// IsAggregate 是否为聚合查询，包含聚合函数或者分组字段
+func (f *Filter) IsAggregate() bool {
+	if len(f.GroupBy) > 0 {
+		return true
+	}
+	for _, c := range f.Projections {
+		if c.Func != "" {
+			return true
+		}
+	}
+	return false
+}
+
 type Condition struct {
 	Depth     int
 	AndOr     string
 	Field     string
 	Operator  string
 	Value     interface{} // 通过detectType 赋值为精确类型值，detectType之前都是string
-	ValueType string      // number, string, bool, time
+	ValueType string      // number, string, bool, time, list, quantity
+	Subquery  *Subquery   `json:",omitempty"` // in、not in 的子查询，执行查询时解析为值列表
+}
+
+// ConditionExpr where 条件表达式树
+// Logic 为 AND、OR、NOT 时为逻辑节点，子表达式存放在Children中，NOT 只有一个子表达式
+// Logic 为空时为叶子节点，比较条件存放在Condition中
+type ConditionExpr struct {
+	Logic     string           `json:"logic,omitempty"`
+	Children  []*ConditionExpr `json:"children,omitempty"`
+	Condition *Condition       `json:"condition,omitempty"`
+}
+
+// Flatten 按从左到右的顺序展开表达式树中的全部比较条件
+func (e *ConditionExpr) Flatten() []Condition {
+	if e == nil {
+		return nil
+	}
+	if e.Condition != nil {
+		return []Condition{*e.Condition}
+	}
+	var conditions []Condition
+	for _, child := range e.Children {
+		conditions = append(conditions, child.Flatten()...)
+	}
+	return conditions
+}
+
+// String 将表达式转换为sql条件，用于展示执行计划
+func (e *ConditionExpr) String() string {
+	if e == nil {
+		return ""
+	}
+	if e.Condition != nil {
+		return e.Condition.String()
+	}
+	parts := make([]string, 0, len(e.Children))
+	for _, child := range e.Children {
+		if child.Condition != nil || child.Logic == "NOT" {
+			parts = append(parts, child.String())
+		} else {
+			parts = append(parts, "("+child.String()+")")
+		}
+	}
+	if e.Logic == "NOT" {
+		return "not (" + strings.Join(parts, "") + ")"
+	}
+	return strings.Join(parts, " "+strings.ToLower(e.Logic)+" ")
+}
+
+// String 将比较条件转换为sql条件，如 metadata.name = 'abc'
+func (c Condition) String() string {
+	switch {
+	case c.Subquery != nil:
+		return fmt.Sprintf("%s %s (%s)", c.Field, c.Operator, c.Subquery.Sql)
+	case c.Operator == "is null" || c.Operator == "is not null":
+		return fmt.Sprintf("%s %s", c.Field, c.Operator)
+	case c.Operator == "between" || c.Operator == "not between":
+		if values, ok := c.Value.([]interface{}); ok && len(values) == 2 {
+			return fmt.Sprintf("%s %s %s and %s", c.Field, c.Operator, formatConditionValue(values[0]), formatConditionValue(values[1]))
+		}
+	}
+	if values, ok := c.Value.([]interface{}); ok {
+		items := make([]string, 0, len(values))
+		for _, v := range values {
+			items = append(items, formatConditionValue(v))
+		}
+		return fmt.Sprintf("%s %s (%s)", c.Field, c.Operator, strings.Join(items, ", "))
+	}
+	return fmt.Sprintf("%s %s %s", c.Field, c.Operator, formatConditionValue(c.Value))
+}
+
+// formatConditionValue 字符串、时间加引号，其他值原样输出
+func formatConditionValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "\\'") + "'"
+	case time.Time:
+		return "'" + v.Format(time.RFC3339) + "'"
+	case resource.Quantity:
+		return "'" + v.String() + "'"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%v", value)
 }
 
 func (s *Statement) ParseGVKs(gvks []schema.GroupVersionKind, versions ...string) *Statement {
@@ -0,0 +1,87 @@
+package kom
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Table 表格形式的查询结果，与 kubectl get 的输出一致
+// 内置资源使用api server返回的表格列，CRD使用 additionalPrinterColumns 在本地计算
+type Table struct {
+	Columns []TableColumn `json:"columns"`
+	Rows    []TableRow    `json:"rows"`
+}
+
+// TableColumn 表格列
+type TableColumn struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`                  // integer、number、string、boolean、date
+	Format      string `json:"format,omitempty"`      // 如 name 表示对象名称列
+	Description string `json:"description,omitempty"` // 列的说明
+	Priority    int32  `json:"priority,omitempty"`    // 大于0时为 kubectl get -o wide 才显示的列
+	JSONPath    string `json:"jsonPath,omitempty"`    // CRD打印列的JSONPath，api server生成的列为空
+}
+
+// TableRow 表格行，Cells与Columns一一对应
+// integer 列为int64，number 列为float64，boolean 列为bool，其他列为string，字段不存在时为nil
+type TableRow struct {
+	Namespace string        `json:"namespace,omitempty"`
+	Name      string        `json:"name"`
+	Cells     []interface{} `json:"cells"`
+}
+
+// Table 查询资源并以表格形式返回，列与 kubectl get 一致，支持where、order by、limit等条件，不支持分组聚合及关联查询
+//
+//	var table kom.Table
+//	err := kom.DefaultCluster().Resource(&corev1.Pod{}).Namespace("kube-system").Table(&table).Error
+//	err := kom.DefaultCluster().Sql("select * from deploy where metadata.namespace='default' order by metadata.name").Table(&table).Error
+func (k *Kubectl) Table(table *Table, opt ...metav1.ListOptions) *Kubectl {
+	tx := k.getInstance()
+	tx.mergeListOptions(opt)
+	tx.Statement.Dest = table
+	tx.Error = tx.Callback().Table().Execute(tx)
+	return tx
+}
+
+// CRDPrinterColumns 当前资源为CRD时返回该版本定义的打印列，第一列为名称
+// 未定义 additionalPrinterColumns 时与api server一致，使用名称及创建时间两列
+func (s *Statement) CRDPrinterColumns() ([]TableColumn, bool) {
+	cluster := s.parentCluster()
+	if cluster == nil {
+		return nil, false
+	}
+	for _, crd := range cluster.crdList {
+		group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+		plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+		if group != s.GVR.Group || plural != s.GVR.Resource {
+			continue
+		}
+		columns := []TableColumn{{Name: "Name", Type: "string", Format: "name", Description: "Name must be unique within a namespace."}}
+		versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+		for _, v := range versions {
+			version, ok := v.(map[string]interface{})
+			if !ok || version["name"] != s.GVR.Version {
+				continue
+			}
+			printerColumns, _, _ := unstructured.NestedSlice(version, "additionalPrinterColumns")
+			for _, c := range printerColumns {
+				column, ok := c.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				name, _, _ := unstructured.NestedString(column, "name")
+				typ, _, _ := unstructured.NestedString(column, "type")
+				format, _, _ := unstructured.NestedString(column, "format")
+				description, _, _ := unstructured.NestedString(column, "description")
+				priority, _, _ := unstructured.NestedInt64(column, "priority")
+				jsonPath, _, _ := unstructured.NestedString(column, "jsonPath")
+				columns = append(columns, TableColumn{Name: name, Type: typ, Format: format, Description: description, Priority: int32(priority), JSONPath: jsonPath})
+			}
+		}
+		if len(columns) == 1 {
+			columns = append(columns, TableColumn{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp"})
+		}
+		return columns, true
+	}
+	return nil, false
+}
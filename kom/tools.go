@@ -16,6 +16,9 @@ type tools struct {
 
 func (u *tools) ClearCache() {
 	u.kubectl.ClusterCache().Clear()
+	if index := u.kubectl.Statement.cacheIndex(); index != nil {
+		index.clear()
+	}
 }
 
 // ConvertRuntimeObjectToTypedObject 是一个通用的转换函数，将 runtime.Object 转换为指定的目标类型
@@ -216,6 +219,10 @@ func (u *tools) FindGVKByTableNameInApiResources(tableName string) *schema.Group
 			}
 		}
 	}
+	// 虚拟表使用父资源的GVK
+	if v, ok := GetVirtualTable(tableName); ok && v.Parent != tableName {
+		return u.FindGVKByTableNameInApiResources(v.Parent)
+	}
 	return nil // 没有匹配的资源
 }
 
@@ -270,6 +277,8 @@ func (u *tools) ListAvailableTableNames() (names []string) {
 		}
 	}
 
+	names = append(names, virtualTableNames()...)
+
 	names = slice.Unique(names)
 	names = slice.Filter(names, func(index int, item string) bool {
 		return !strings.Contains(item, "Option")
@@ -7,10 +7,12 @@ import (
 
 // 定义字符串的类型
 const (
-	TypeNumber  = "number"
-	TypeTime    = "time"
-	TypeString  = "string"
-	TypeBoolean = "boolean"
+	TypeNumber   = "number"
+	TypeTime     = "time"
+	TypeString   = "string"
+	TypeBoolean  = "boolean"
+	TypeList     = "list"     // in、between 条件的值列表
+	TypeQuantity = "quantity" // k8s资源数量，如 500m、512Mi
 )
 
 // DetectType 探测字符串的类型（数字、时间、字符串）
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RelativeTime 相对于当前时间的时间点，如 now() - interval 7 day
+// 比较时才计算具体时间，查询条件重复执行或长时间使用时不会因解析时间而偏移
+type RelativeTime struct {
+	Months   int           `json:"months,omitempty"`   // 月份偏移，interval month、year 按自然月计算
+	Duration time.Duration `json:"duration,omitempty"` // 时长偏移
+}
+
+// Time 计算当前对应的时间
+func (r RelativeTime) Time() time.Time {
+	return time.Now().AddDate(0, r.Months, 0).Add(r.Duration)
+}
+
+// String 返回 now() - 168h0m0s 形式的表达式
+func (r RelativeTime) String() string {
+	s := "now()"
+	if r.Months != 0 {
+		s += fmt.Sprintf(" %s interval %d month", sign(r.Months < 0), abs(r.Months))
+	}
+	if r.Duration != 0 {
+		s += fmt.Sprintf(" %s %s", sign(r.Duration < 0), r.Duration.Abs())
+	}
+	return s
+}
+
+func sign(negative bool) string {
+	if negative {
+		return "-"
+	}
+	return "+"
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// dayDurationRegexp 以天、周为单位的时长
+var dayDurationRegexp = regexp.MustCompile(`^(\d+)([dw])`)
+
+// ParseDuration 解析时长，在 time.ParseDuration 的基础上支持 d（天）、w（周），如 7d、1d12h、2w
+func ParseDuration(value string) (time.Duration, error) {
+	s := strings.TrimSpace(value)
+	var total time.Duration
+	consumed := false
+	for {
+		m := dayDurationRegexp.FindStringSubmatch(s)
+		if m == nil {
+			break
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		unit := 24 * time.Hour
+		if m[2] == "w" {
+			unit *= 7
+		}
+		total += time.Duration(n) * unit
+		s = s[len(m[0]):]
+		consumed = true
+	}
+	if s == "" && consumed {
+		return total, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return total + d, nil
+}
+
+// IntervalDuration 计算 sql interval 的时长，如 interval 7 day
+// unit 支持 microsecond、second、minute、hour、day、week 及复数形式，返回值为时长
+// month、year 没有固定时长，返回月份数，由调用方按自然月计算
+func IntervalDuration(n float64, unit string) (time.Duration, int, error) {
+	switch strings.TrimSuffix(strings.ToLower(unit), "s") {
+	case "microsecond":
+		return time.Duration(n * float64(time.Microsecond)), 0, nil
+	case "second":
+		return time.Duration(n * float64(time.Second)), 0, nil
+	case "minute":
+		return time.Duration(n * float64(time.Minute)), 0, nil
+	case "hour":
+		return time.Duration(n * float64(time.Hour)), 0, nil
+	case "day":
+		return time.Duration(n * float64(24*time.Hour)), 0, nil
+	case "week":
+		return time.Duration(n * float64(7*24*time.Hour)), 0, nil
+	case "month":
+		if n != float64(int(n)) {
+			return 0, 0, fmt.Errorf("interval %v month must be an integer", n)
+		}
+		return 0, int(n), nil
+	case "year":
+		if n != float64(int(n)) {
+			return 0, 0, fmt.Errorf("interval %v year must be an integer", n)
+		}
+		return 0, int(n) * 12, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported interval unit %s", unit)
+}
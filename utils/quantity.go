@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"strconv"
 
 	"k8s.io/apimachinery/pkg/api/resource"
 )
@@ -76,3 +77,16 @@ func formatDecimalSI(value int64) string {
 		return fmt.Sprintf("%d", value)
 	}
 }
+
+// ParseQuantity 解析带单位的k8s资源数量，如 500m、2Gi、100G
+// 纯数字返回false，按数字处理
+func ParseQuantity(value string) (resource.Quantity, bool) {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return resource.Quantity{}, false
+	}
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return resource.Quantity{}, false
+	}
+	return q, true
+}
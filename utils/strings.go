@@ -166,3 +166,30 @@ func StringListToSQLIn(strList []string) string {
 
 	return "(" + strings.Join(parts, ", ") + ")"
 }
+
+// SplitTopLevel 按分隔符拆分字符串，忽略引号、反引号、括号、中括号内的分隔符
+// 例如 "a, count(b,c), `d,e`" 按逗号拆分为 ["a", " count(b,c)", " `d,e`"]
+func SplitTopLevel(s string, sep rune) []string {
+	var parts []string
+	var quote rune
+	depth := 0
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(' || r == '[':
+			depth++
+		case r == ')' || r == ']':
+			depth--
+		case r == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + utf8.RuneLen(r)
+		}
+	}
+	return append(parts, s[start:])
+}
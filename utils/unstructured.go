@@ -9,7 +9,7 @@ import (
 )
 
 func SortByCreationTime(items []unstructured.Unstructured) []unstructured.Unstructured {
-	sort.Slice(items, func(i, j int) bool {
+	sort.SliceStable(items, func(i, j int) bool {
 		ti := items[i].GetCreationTimestamp()
 		tj := items[j].GetCreationTimestamp()
 		return ti.After(tj.Time)